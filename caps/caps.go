@@ -29,6 +29,8 @@ import "github.com/byte-mug/fastnntp"
 import "github.com/byte-mug/fastnntp/posting"
 import "github.com/maxymania/fastnntp-polyglot"
 import "github.com/maxymania/fastnntp-polyglot/buffer"
+import "github.com/maxymania/fastnntp-polyglot/gold/journal"
+import "github.com/maxymania/fastnntp-polyglot/gold/postlock"
 import "bytes"
 import "fmt"
 
@@ -67,12 +69,37 @@ type Caps struct{
 	ArticleGroupDB newspolyglot.ArticleGroupDB
 	GroupRealtimeDB newspolyglot.GroupRealtimeDB
 	GroupStaticDB newspolyglot.GroupStaticDB
+	
+	// Optional: Records the steps of every posting.
+	Journal *journal.Journal
+	
+	// Optional: Guards against concurrent postings of the same article.
+	// Defaults to postlock.Default (in-process).
+	PostLock postlock.Locker
+	
+	// Optional: Accepted articles are written into the Spool, which posts them
+	// using PostArticle() in the background.
+	Spool Spooler
+}
+
+/*
+A local queue of accepted articles, that have not been posted yet.
+*/
+type Spooler interface {
+	// Returns true, if an article with this Message-ID is in the spool.
+	SpoolHas(id []byte) bool
+	
+	// Adds an article to the spool. Returns false, if an article with the
+	// same Message-ID is already in the spool.
+	SpoolPost(headp *posting.HeadInfo, body []byte) (ok bool, err error)
 }
 
 
 func (a *Caps) CheckPost() (possible bool) { return a.ArticlePostingDB.ArticlePostingCheckPost() }
 func (a *Caps) CheckPostId(id []byte) (wanted bool, possible bool) {
-	return a.ArticlePostingDB.ArticlePostingCheckPostId(id)
+	wanted,possible = a.ArticlePostingDB.ArticlePostingCheckPostId(id)
+	if wanted && a.Spool!=nil { wanted = !a.Spool.SpoolHas(id) }
+	return
 }
 
 func (a *Caps) PerformPost(id []byte, r *fastnntp.DotReader) (rejected bool, failed bool) {
@@ -84,6 +111,39 @@ func (a *Caps) PerformPost(id []byte, r *fastnntp.DotReader) (rejected bool, fai
 	
 	if len(headp.MessageId)==0 { return false,true } // no message-ID? Failed.
 	
+	if a.Spool!=nil {
+		if len(posting.SplitNewsgroups(headp.Newsgroups))==0 { return true,false }
+		
+		// Don't accept articles, that the posting backend would not take.
+		if !a.CheckPost() { return false,true }
+		wanted,possible := a.CheckPostId(headp.MessageId)
+		if !wanted { return true,false }
+		if !possible { return false,true }
+		ok,e := a.Spool.SpoolPost(headp,body)
+		if e!=nil { return false,true }
+		return !ok,false
+	}
+	return a.PostArticle(headp,body)
+}
+
+/*
+Posts an article, that has been parsed by posting.ParseAndProcessHeader().
+It is used by PerformPost() and by the Spool.
+*/
+func (a *Caps) PostArticle(headp *posting.HeadInfo, body []byte) (rejected bool, failed bool) {
+	// Is the same article being posted right now? Reject as duplicate.
+	pl := a.PostLock
+	if pl==nil { pl = postlock.Default }
+	if ok,e := pl.TryLock(headp.MessageId); e!=nil {
+		return false,true
+	} else if !ok {
+		return true,false
+	}
+	defer pl.Unlock(headp.MessageId)
+	
+	// Already have it (or had it, before it expired)? Reject.
+	if wanted,_ := a.ArticlePostingDB.ArticlePostingCheckPostId(headp.MessageId); !wanted { return true,false }
+	
 	ngrps := posting.SplitNewsgroups(headp.Newsgroups)
 	if len(ngrps)==0 { return true,false }
 	ngrps = Dedupe(ngrps)
@@ -95,12 +155,18 @@ func (a *Caps) PerformPost(id []byte, r *fastnntp.DotReader) (rejected bool, fai
 	nums,e := a.GroupHeadDB.GroupHeadInsert(ngrps,nil)
 	if e!=nil { return false,true }
 	
+	if e = a.Journal.Begin(headp.MessageId,ngrps,nums); e!=nil {
+		a.GroupHeadDB.GroupHeadRevert(ngrps,nums)
+		return false,true
+	}
+	
 	rej,fl,e := a.ArticlePostingDB.ArticlePostingPost(headp,body,ngrps,nums)
 	if e!=nil { fl = true }
 	
 	if rej||fl {
 		a.GroupHeadDB.GroupHeadRevert(ngrps,nums)
 	}
+	a.Journal.End(headp.MessageId)
 	return rej,fl
 }
 
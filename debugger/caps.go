@@ -0,0 +1,246 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package debugger
+
+import (
+	"github.com/byte-mug/fastnntp"
+	"github.com/byte-mug/fastnntp/posting"
+	"github.com/maxymania/fastnntp-polyglot"
+	"github.com/maxymania/fastnntp-polyglot/caps"
+	"github.com/maxymania/fastnntp-polyglot/gold"
+	"sync"
+)
+
+/*
+Traces the calls to a caps.Caps. It is used in place of the Caps.
+
+Every call gets a request ID, that is attached to the events of the backend
+calls, that are made on its behalf, including the calls of the gold wrappers
+(PostingImpl, GroupRealtimeImpl, ...) to their parts.
+
+Wrap the Caps after it has been set up completely: the traced copies of the
+backends are built once and reused. The gold wrappers are found behind
+decorators, that implement gold.Rewrapper (those of the breaker, faults,
+metrics and replay packages do); behind other decorators, the calls to their
+parts are not traced.
+
+A Caps can be created as a struct literal or with Wrap.
+*/
+type Caps struct {
+	Inner  *caps.Caps
+	Tracer *Tracer
+	
+	// Optional: Returns the ID, that the fastnntp server assigned to the
+	// request being served. If nil (or it returns ""), an ID is generated.
+	// Use a Caps per connection (see WithRequestID), if the function depends
+	// on the connection.
+	RequestID func() string
+	
+	pool *sync.Pool
+	init sync.Once
+}
+
+func Wrap(c *caps.Caps, t *Tracer) *Caps { return &Caps{Inner:c,Tracer:t} }
+
+/*
+Returns a Caps, that takes the request IDs from f. It shares the traced
+backends with d.
+*/
+func (d *Caps) WithRequestID(f func() string) *Caps {
+	return &Caps{Inner:d.Inner,Tracer:d.Tracer,RequestID:f,pool:d.getPool()}
+}
+
+// The pool is shared by the Caps, that are derived with WithRequestID.
+func (d *Caps) getPool() *sync.Pool {
+	d.init.Do(func() {
+		if d.pool==nil { d.pool = new(sync.Pool) }
+	})
+	return d.pool
+}
+
+/*
+A traced copy of the Caps. Its decorators report to s, which is set for every
+request, so the copy is reused, instead of being built per request.
+*/
+type traced struct {
+	c caps.Caps
+	s scope
+}
+func (d *Caps) build() *traced {
+	t := new(traced)
+	t.c = *d.Inner
+	c,s := &t.c,&t.s
+	if c.GroupHeadDB!=nil { c.GroupHeadDB = &tGh{c.GroupHeadDB,s} }
+	if c.GroupHeadCache!=nil { c.GroupHeadCache = &tGhc{c.GroupHeadCache,s} }
+	if n := gold.Replace(c.ArticlePostingDB,isPostingImpl,func(i interface{}) interface{} {
+		pc := *i.(*gold.PostingImpl)
+		pc.Dir = &tAdEx{tAd{pc.Dir,s},pc.Dir}
+		pc.Grp = &tAgEx{tAg{pc.Grp,s},pc.Grp}
+		return &pc
+	}); n!=nil {
+		c.ArticlePostingDB = n.(newspolyglot.ArticlePostingDB)
+	}
+	if c.ArticlePostingDB!=nil { c.ArticlePostingDB = &tPost{c.ArticlePostingDB,s} }
+	if n := gold.Replace(c.ArticleGroupDB,isWrapper,func(i interface{}) interface{} {
+		w := i.(*gold.ArticleGroupWrapper)
+		return &gold.ArticleGroupWrapper{&tAg{w.ArticleGroupDB,s},&tAd{w.Direct,s}}
+	}); n!=nil {
+		c.ArticleGroupDB = n.(newspolyglot.ArticleGroupDB)
+	} else if c.ArticleGroupDB!=nil {
+		c.ArticleGroupDB = &tAg{c.ArticleGroupDB,s}
+	}
+	if c.ArticleDirectDB!=nil { c.ArticleDirectDB = &tAd{c.ArticleDirectDB,s} }
+	if n := gold.Replace(c.GroupRealtimeDB,isRealtime,func(i interface{}) interface{} {
+		g := i.(*gold.GroupRealtimeImpl)
+		return &gold.GroupRealtimeImpl{&tAgEx{tAg{g.ArticleGroupEX,s},g.ArticleGroupEX},&tGl{g.List,s}}
+	}); n!=nil {
+		c.GroupRealtimeDB = n.(newspolyglot.GroupRealtimeDB)
+	} else if c.GroupRealtimeDB!=nil {
+		c.GroupRealtimeDB = &tGr{c.GroupRealtimeDB,s}
+	}
+	if n := gold.Replace(c.GroupStaticDB,isStatic,func(i interface{}) interface{} {
+		return &gold.GroupStaticImpl{&tGl{i.(*gold.GroupStaticImpl).List,s}}
+	}); n!=nil {
+		c.GroupStaticDB = n.(newspolyglot.GroupStaticDB)
+	} else if c.GroupStaticDB!=nil {
+		c.GroupStaticDB = &tGs{c.GroupStaticDB,s}
+	}
+	return t
+}
+
+func isPostingImpl(i interface{}) bool { _,ok := i.(*gold.PostingImpl); return ok }
+func isWrapper(i interface{}) bool { _,ok := i.(*gold.ArticleGroupWrapper); return ok }
+func isRealtime(i interface{}) bool { _,ok := i.(*gold.GroupRealtimeImpl); return ok }
+func isStatic(i interface{}) bool { _,ok := i.(*gold.GroupStaticImpl); return ok }
+
+func artArgs(ar *fastnntp.Article) kv {
+	a := kv{}
+	if ar.HasId { a["msgid"] = string(ar.MessageId) }
+	if ar.HasNum { a["group"] = string(ar.Group); a["num"] = ar.Number }
+	return a
+}
+
+// Returns the Caps to be used for the request. If the request is sampled,
+// it's a traced copy, whose decorators report to the request's scope.
+func (d *Caps) begin(op string, args kv) (*caps.Caps, *traced, *Event) {
+	req := d.Tracer.newRequest(d.RequestID)
+	if req=="" { return d.Inner,nil,nil }
+	t,_ := d.getPool().Get().(*traced)
+	if t==nil { t = d.build() }
+	t.s = scope{t:d.Tracer,req:req}
+	ev := t.s.start("request",op,args)
+	t.s.parent = ev.Span
+	return &t.c,t,ev
+}
+func (d *Caps) end(t *traced, ev *Event, res kv) {
+	if t==nil { return }
+	t.s.done(ev,res)
+	t.s = scope{}
+	d.getPool().Put(t)
+}
+
+func (d *Caps) CheckPost() (possible bool) {
+	c,r,e := d.begin("CheckPost",nil)
+	possible = c.CheckPost()
+	d.end(r,e,kv{"possible":possible})
+	return
+}
+func (d *Caps) CheckPostId(id []byte) (wanted bool, possible bool) {
+	c,r,e := d.begin("CheckPostId",kv{"msgid":string(id)})
+	wanted,possible = c.CheckPostId(id)
+	d.end(r,e,kv{"wanted":wanted,"possible":possible})
+	return
+}
+func (d *Caps) PerformPost(id []byte, rd *fastnntp.DotReader) (rejected bool, failed bool) {
+	c,r,e := d.begin("PerformPost",kv{"msgid":string(id)})
+	rejected,failed = c.PerformPost(id,rd)
+	d.end(r,e,kv{"rejected":rejected,"failed":failed})
+	return
+}
+func (d *Caps) PostArticle(headp *posting.HeadInfo, body []byte) (rejected bool, failed bool) {
+	c,r,e := d.begin("PostArticle",kv{"msgid":string(headp.MessageId),"head":len(headp.RAW),"body":len(body)})
+	rejected,failed = c.PostArticle(headp,body)
+	d.end(r,e,kv{"rejected":rejected,"failed":failed})
+	return
+}
+func (d *Caps) StatArticle(ar *fastnntp.Article) bool {
+	c,r,e := d.begin("StatArticle",artArgs(ar))
+	ok := c.StatArticle(ar)
+	d.end(r,e,kv{"found":ok})
+	return ok
+}
+func (d *Caps) GetArticle(ar *fastnntp.Article, head, body bool) func(w *fastnntp.DotWriter) {
+	args := artArgs(ar)
+	args["head"],args["body"] = head,body
+	c,r,e := d.begin("GetArticle",args)
+	f := c.GetArticle(ar,head,body)
+	if f==nil || r==nil {
+		d.end(r,e,kv{"found":f!=nil})
+		return f
+	}
+	// The span ends, after the article has been written.
+	return func(w *fastnntp.DotWriter) {
+		f(w)
+		d.end(r,e,kv{"found":true})
+	}
+}
+func (d *Caps) WriteOverview(ar *fastnntp.ArticleRange) func(w fastnntp.IOverview) {
+	args := kv{}
+	if ar.HasId { args["msgid"] = string(ar.MessageId) }
+	if ar.HasNum { args["group"] = string(ar.Group); args["first"] = ar.Number; args["last"] = ar.LastNumber }
+	c,r,e := d.begin("WriteOverview",args)
+	f := c.WriteOverview(ar)
+	if f==nil || r==nil {
+		d.end(r,e,kv{"found":f!=nil})
+		return f
+	}
+	return func(w fastnntp.IOverview) {
+		f(w)
+		d.end(r,e,kv{"found":true})
+	}
+}
+func (d *Caps) CursorMoveGroup(g *fastnntp.Group, i int64, backward bool, id_buf []byte) (ni int64, id []byte, ok bool) {
+	c,r,e := d.begin("CursorMoveGroup",kv{"group":string(g.Group),"num":i,"backward":backward})
+	ni,id,ok = c.CursorMoveGroup(g,i,backward,id_buf)
+	d.end(r,e,kv{"found":ok,"num":ni,"msgid":string(id)})
+	return
+}
+func (d *Caps) ListGroup(g *fastnntp.Group, w *fastnntp.DotWriter, first, last int64) {
+	c,r,e := d.begin("ListGroup",kv{"group":string(g.Group),"first":first,"last":last})
+	c.ListGroup(g,w,first,last)
+	d.end(r,e,nil)
+}
+func (d *Caps) GetGroup(g *fastnntp.Group) bool {
+	c,r,e := d.begin("GetGroup",kv{"group":string(g.Group)})
+	ok := c.GetGroup(g)
+	d.end(r,e,kv{"found":ok})
+	return ok
+}
+func (d *Caps) ListGroups(wm *fastnntp.WildMat, ila fastnntp.IListActive) bool {
+	c,r,e := d.begin("ListGroups",nil)
+	ok := c.ListGroups(wm,ila)
+	d.end(r,e,kv{"ok":ok})
+	return ok
+}
@@ -20,7 +20,13 @@ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
 SOFTWARE.
 */
 
+/*
+Debugging aids.
 
+AgDB and AdDB log the calls to a backend. Caps traces whole requests: the
+calls to the Caps and the backend calls made on their behalf are emitted as
+JSON events, correlated by a request ID.
+*/
 package debugger
 
 import "fmt"
@@ -29,7 +35,7 @@ import "github.com/maxymania/fastnntp-polyglot"
 
 func StringifyArticle(aobj *newspolyglot.ArticleObject) string {
 	if aobj==nil { return "<nil>" }
-	return fmt.Sprintf("{%p %p}",aobj.Head,aobj.Body)
+	return fmt.Sprintf("{head:%d body:%d}",len(aobj.Head),len(aobj.Body))
 }
 
 func StringifyOverview(aov *newspolyglot.ArticleOverview) string {
@@ -56,6 +62,22 @@ func (a AgDB) ArticleGroupMove(group []byte, i int64, backward bool, id_buf []by
 	log.Printf("ArticleGroupMove(%q %d %v) -> %d %q %v",group,i,backward,ni,id,ok)
 	return
 }
+func (a AgDB) ArticleGroupOverview(group []byte, first, last int64, targ func(int64, *newspolyglot.ArticleOverview)) {
+	n := 0
+	a.ArticleGroupDB.ArticleGroupOverview(group,first,last,func(num int64, ov *newspolyglot.ArticleOverview) {
+		n++
+		targ(num,ov)
+	})
+	log.Printf("ArticleGroupOverview(%q %d %d) -> %d entries",group,first,last,n)
+}
+func (a AgDB) ArticleGroupList(group []byte, first, last int64, targ func(int64)) {
+	n := 0
+	a.ArticleGroupDB.ArticleGroupList(group,first,last,func(num int64) {
+		n++
+		targ(num)
+	})
+	log.Printf("ArticleGroupList(%q %d %d) -> %d entries",group,first,last,n)
+}
 
 type AdDB struct {
 	newspolyglot.ArticleDirectDB
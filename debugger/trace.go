@@ -0,0 +1,160 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package debugger
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+A structured trace event. One is emitted for every traced call.
+*/
+type Event struct {
+	Time     time.Time              `json:"time"`
+	Request  string                 `json:"req"`
+	Span     string                 `json:"span"`
+	Parent   string                 `json:"parent,omitempty"`
+	Layer    string                 `json:"layer"`
+	Op       string                 `json:"op"`
+	Args     map[string]interface{} `json:"args,omitempty"`
+	Result   map[string]interface{} `json:"result,omitempty"`
+	Duration int64                  `json:"dur_us"`
+}
+
+/*
+Receives the finished spans.
+*/
+type SpanExporter interface {
+	ExportSpan(e *Event) error
+}
+
+/*
+A SpanExporter, that appends the spans as JSON lines to a local file.
+*/
+type FileExporter struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func NewFileExporter(path string) (*FileExporter,error) {
+	f,err := os.OpenFile(path,os.O_CREATE|os.O_APPEND|os.O_WRONLY,0644)
+	if err!=nil { return nil,err }
+	return &FileExporter{f:f,enc:json.NewEncoder(f)},nil
+}
+func (f *FileExporter) ExportSpan(e *Event) error {
+	f.mu.Lock(); defer f.mu.Unlock()
+	return f.enc.Encode(e)
+}
+func (f *FileExporter) Close() error {
+	f.mu.Lock(); defer f.mu.Unlock()
+	return f.f.Close()
+}
+
+/*
+The Tracer writes trace events as JSON lines to Out and passes them to the
+SpanExporter.
+*/
+type Tracer struct {
+	// Where the events are written to. Defaults to os.Stderr.
+	Out io.Writer
+	
+	// Optional: Receives every event as span.
+	Spans SpanExporter
+	
+	// Only every n-th request is traced. 0 and 1 trace every request.
+	SampleEvery uint64
+	
+	once   sync.Once
+	prefix string
+	reqs   uint64
+	spans  uint64
+	mu     sync.Mutex
+}
+
+func (t *Tracer) init() {
+	var b [4]byte
+	rand.Read(b[:])
+	t.prefix = hex.EncodeToString(b[:])
+}
+
+// Returns the request ID (from f, if set), or "", if the request is not sampled.
+func (t *Tracer) newRequest(f func() string) string {
+	t.once.Do(t.init)
+	n := atomic.AddUint64(&t.reqs,1)
+	if t.SampleEvery>1 && n%t.SampleEvery!=0 { return "" }
+	if f!=nil {
+		if id := f(); id!="" { return id }
+	}
+	return t.prefix+"-"+strconv.FormatUint(n,16)
+}
+func (t *Tracer) newSpan() string {
+	return strconv.FormatUint(atomic.AddUint64(&t.spans,1),16)
+}
+
+func (t *Tracer) emit(e *Event) {
+	t.mu.Lock()
+	out := t.Out
+	if out==nil { out = os.Stderr }
+	b,_ := json.Marshal(e)
+	out.Write(append(b,'\n'))
+	t.mu.Unlock()
+	if t.Spans!=nil { t.Spans.ExportSpan(e) }
+}
+
+/*
+The trace context of a request.
+*/
+type scope struct {
+	t      *Tracer
+	req    string
+	parent string
+}
+
+// Starts a span. Call done() with the result, to emit it.
+func (s *scope) start(layer, op string, args map[string]interface{}) *Event {
+	return &Event{
+		Time: time.Now(),
+		Request: s.req,
+		Span: s.t.newSpan(),
+		Parent: s.parent,
+		Layer: layer,
+		Op: op,
+		Args: args,
+	}
+}
+func (s *scope) done(e *Event, result map[string]interface{}) {
+	e.Duration = int64(time.Since(e.Time)/time.Microsecond)
+	e.Result = result
+	s.t.emit(e)
+}
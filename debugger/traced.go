@@ -0,0 +1,282 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package debugger
+
+import (
+	"github.com/maxymania/fastnntp-polyglot"
+	"github.com/maxymania/fastnntp-polyglot/gold"
+	"github.com/maxymania/fastnntp-polyglot/postauth"
+	"github.com/byte-mug/fastnntp/posting"
+)
+
+type kv = map[string]interface{}
+
+func artSize(o *newspolyglot.ArticleObject) kv {
+	if o==nil { return kv{"found":false} }
+	return kv{"found":true,"head":len(o.Head),"body":len(o.Body)}
+}
+func ovSize(o *newspolyglot.ArticleOverview) kv {
+	if o==nil { return kv{"found":false} }
+	return kv{"found":true,"msgid":string(o.MsgId),"bytes":o.Bytes,"lines":o.Lines}
+}
+func errStr(err error) interface{} {
+	if err==nil { return nil }
+	return err.Error()
+}
+func strs(b [][]byte) []string {
+	s := make([]string,len(b))
+	for i,e := range b { s[i] = string(e) }
+	return s
+}
+
+const lBackend = "backend"
+
+type tGhc struct {
+	inner newspolyglot.GroupHeadCache
+	s *scope
+}
+func (d *tGhc) GroupHeadFilter(groups [][]byte) ([][]byte,error) {
+	e := d.s.start(lBackend,"GroupHeadFilter",kv{"groups":strs(groups)})
+	r,err := d.inner.GroupHeadFilter(groups)
+	d.s.done(e,kv{"groups":strs(r),"err":errStr(err)})
+	return r,err
+}
+
+type tGh struct {
+	inner newspolyglot.GroupHeadDB
+	s *scope
+}
+func (d *tGh) GroupHeadInsert(groups [][]byte, buf []int64) ([]int64,error) {
+	e := d.s.start(lBackend,"GroupHeadInsert",kv{"groups":strs(groups)})
+	r,err := d.inner.GroupHeadInsert(groups,buf)
+	d.s.done(e,kv{"nums":r,"err":errStr(err)})
+	return r,err
+}
+func (d *tGh) GroupHeadRevert(groups [][]byte, nums []int64) error {
+	e := d.s.start(lBackend,"GroupHeadRevert",kv{"groups":strs(groups),"nums":nums})
+	err := d.inner.GroupHeadRevert(groups,nums)
+	d.s.done(e,kv{"err":errStr(err)})
+	return err
+}
+
+type tPost struct {
+	inner newspolyglot.ArticlePostingDB
+	s *scope
+}
+func (d *tPost) ArticlePostingPost(headp *posting.HeadInfo, body []byte, ngs [][]byte, numbs []int64) (rejected bool, failed bool, err error) {
+	e := d.s.start(lBackend,"ArticlePostingPost",kv{"msgid":string(headp.MessageId),"head":len(headp.RAW),"body":len(body),"groups":strs(ngs),"nums":numbs})
+	rejected,failed,err = d.inner.ArticlePostingPost(headp,body,ngs,numbs)
+	d.s.done(e,kv{"rejected":rejected,"failed":failed,"err":errStr(err)})
+	return
+}
+func (d *tPost) ArticlePostingCheckPost() (possible bool) {
+	e := d.s.start(lBackend,"ArticlePostingCheckPost",nil)
+	possible = d.inner.ArticlePostingCheckPost()
+	d.s.done(e,kv{"possible":possible})
+	return
+}
+func (d *tPost) ArticlePostingCheckPostId(id []byte) (wanted bool, possible bool) {
+	e := d.s.start(lBackend,"ArticlePostingCheckPostId",kv{"msgid":string(id)})
+	wanted,possible = d.inner.ArticlePostingCheckPostId(id)
+	d.s.done(e,kv{"wanted":wanted,"possible":possible})
+	return
+}
+
+type tAd struct {
+	inner newspolyglot.ArticleDirectDB
+	s *scope
+}
+func (d *tAd) ArticleDirectStat(id []byte) bool {
+	e := d.s.start(lBackend,"ArticleDirectStat",kv{"msgid":string(id)})
+	ok := d.inner.ArticleDirectStat(id)
+	d.s.done(e,kv{"found":ok})
+	return ok
+}
+func (d *tAd) ArticleDirectGet(id []byte, head, body bool) *newspolyglot.ArticleObject {
+	e := d.s.start(lBackend,"ArticleDirectGet",kv{"msgid":string(id),"head":head,"body":body})
+	o := d.inner.ArticleDirectGet(id,head,body)
+	d.s.done(e,artSize(o))
+	return o
+}
+func (d *tAd) ArticleDirectOverview(id []byte) *newspolyglot.ArticleOverview {
+	e := d.s.start(lBackend,"ArticleDirectOverview",kv{"msgid":string(id)})
+	o := d.inner.ArticleDirectOverview(id)
+	d.s.done(e,ovSize(o))
+	return o
+}
+
+type tAg struct {
+	inner newspolyglot.ArticleGroupDB
+	s *scope
+}
+func (d *tAg) ArticleGroupStat(group []byte, num int64, id_buf []byte) ([]byte, bool) {
+	e := d.s.start(lBackend,"ArticleGroupStat",kv{"group":string(group),"num":num})
+	id,ok := d.inner.ArticleGroupStat(group,num,id_buf)
+	d.s.done(e,kv{"found":ok,"msgid":string(id)})
+	return id,ok
+}
+func (d *tAg) ArticleGroupGet(group []byte, num int64, head, body bool, id_buf []byte) ([]byte, *newspolyglot.ArticleObject) {
+	e := d.s.start(lBackend,"ArticleGroupGet",kv{"group":string(group),"num":num,"head":head,"body":body})
+	id,o := d.inner.ArticleGroupGet(group,num,head,body,id_buf)
+	r := artSize(o)
+	r["msgid"] = string(id)
+	d.s.done(e,r)
+	return id,o
+}
+func (d *tAg) ArticleGroupOverview(group []byte, first, last int64, targ func(int64, *newspolyglot.ArticleOverview)) {
+	e := d.s.start(lBackend,"ArticleGroupOverview",kv{"group":string(group),"first":first,"last":last})
+	n,bytes := 0,int64(0)
+	d.inner.ArticleGroupOverview(group,first,last,func(num int64, ov *newspolyglot.ArticleOverview) {
+		n++
+		if ov!=nil { bytes += int64(len(ov.Subject)+len(ov.From)+len(ov.Date)+len(ov.MsgId)+len(ov.Refs)) }
+		targ(num,ov)
+	})
+	d.s.done(e,kv{"entries":n,"bytes":bytes})
+}
+func (d *tAg) ArticleGroupMove(group []byte, i int64, backward bool, id_buf []byte) (ni int64, id []byte, ok bool) {
+	e := d.s.start(lBackend,"ArticleGroupMove",kv{"group":string(group),"num":i,"backward":backward})
+	ni,id,ok = d.inner.ArticleGroupMove(group,i,backward,id_buf)
+	d.s.done(e,kv{"found":ok,"num":ni,"msgid":string(id)})
+	return
+}
+func (d *tAg) ArticleGroupList(group []byte, first, last int64, targ func(int64)) {
+	e := d.s.start(lBackend,"ArticleGroupList",kv{"group":string(group),"first":first,"last":last})
+	n := 0
+	d.inner.ArticleGroupList(group,first,last,func(num int64) {
+		n++
+		targ(num)
+	})
+	d.s.done(e,kv{"entries":n})
+}
+
+type tGr struct {
+	inner newspolyglot.GroupRealtimeDB
+	s *scope
+}
+func (d *tGr) GroupRealtimeQuery(group []byte) (number int64, low int64, high int64, ok bool) {
+	e := d.s.start(lBackend,"GroupRealtimeQuery",kv{"group":string(group)})
+	number,low,high,ok = d.inner.GroupRealtimeQuery(group)
+	d.s.done(e,kv{"found":ok,"number":number,"low":low,"high":high})
+	return
+}
+func (d *tGr) GroupRealtimeList(targ func(group []byte, high, low int64, status byte)) bool {
+	e := d.s.start(lBackend,"GroupRealtimeList",nil)
+	n := 0
+	ok := d.inner.GroupRealtimeList(func(group []byte, high, low int64, status byte) {
+		n++
+		targ(group,high,low,status)
+	})
+	d.s.done(e,kv{"ok":ok,"entries":n})
+	return ok
+}
+
+type tGs struct {
+	inner newspolyglot.GroupStaticDB
+	s *scope
+}
+func (d *tGs) GroupStaticList(targ func(group []byte, descr []byte)) bool {
+	e := d.s.start(lBackend,"GroupStaticList",nil)
+	n := 0
+	ok := d.inner.GroupStaticList(func(group []byte, descr []byte) {
+		n++
+		targ(group,descr)
+	})
+	d.s.done(e,kv{"ok":ok,"entries":n})
+	return ok
+}
+
+/* gold */
+
+type tAgEx struct {
+	tAg
+	ex gold.ArticleGroupEX
+}
+func (d *tAgEx) StoreArticleInfos(groups [][]byte, nums []int64, exp uint64, ov *newspolyglot.ArticleOverview) error {
+	e := d.s.start(lBackend,"StoreArticleInfos",kv{"groups":strs(groups),"nums":nums,"expires":exp,"msgid":string(ov.MsgId)})
+	err := d.ex.StoreArticleInfos(groups,nums,exp,ov)
+	d.s.done(e,kv{"err":errStr(err)})
+	return err
+}
+func (d *tAgEx) GroupRealtimeQuery(group []byte) (number int64, low int64, high int64, ok bool) {
+	e := d.s.start(lBackend,"GroupRealtimeQuery",kv{"group":string(group)})
+	number,low,high,ok = d.ex.GroupRealtimeQuery(group)
+	d.s.done(e,kv{"found":ok,"number":number,"low":low,"high":high})
+	return
+}
+
+type tAdEx struct {
+	tAd
+	ex gold.ArticleDirectEX
+}
+func (d *tAdEx) ArticleDirectStore(exp uint64, ov *newspolyglot.ArticleOverview, obj *newspolyglot.ArticleObject) error {
+	a := artSize(obj)
+	a["msgid"],a["expires"] = string(ov.MsgId),exp
+	e := d.s.start(lBackend,"ArticleDirectStore",a)
+	err := d.ex.ArticleDirectStore(exp,ov,obj)
+	d.s.done(e,kv{"err":errStr(err)})
+	return err
+}
+func (d *tAdEx) ArticleDirectRollback(id []byte) {
+	e := d.s.start(lBackend,"ArticleDirectRollback",kv{"msgid":string(id)})
+	d.ex.ArticleDirectRollback(id)
+	d.s.done(e,nil)
+}
+
+type tGl struct {
+	inner gold.GroupListDB
+	s *scope
+}
+func (d *tGl) AddGroupDescr(group, descr []byte) error {
+	e := d.s.start(lBackend,"AddGroupDescr",kv{"group":string(group),"descr":len(descr)})
+	err := d.inner.AddGroupDescr(group,descr)
+	d.s.done(e,kv{"err":errStr(err)})
+	return err
+}
+func (d *tGl) AddGroupStatus(group []byte, status byte) error {
+	e := d.s.start(lBackend,"AddGroupStatus",kv{"group":string(group),"status":string(status)})
+	err := d.inner.AddGroupStatus(group,status)
+	d.s.done(e,kv{"err":errStr(err)})
+	return err
+}
+func (d *tGl) GroupHeadFilterWithAuth(rank postauth.AuthRank, groups [][]byte) ([][]byte, error) {
+	e := d.s.start(lBackend,"GroupHeadFilterWithAuth",kv{"rank":int(rank),"groups":strs(groups)})
+	r,err := d.inner.GroupHeadFilterWithAuth(rank,groups)
+	d.s.done(e,kv{"groups":strs(r),"err":errStr(err)})
+	return r,err
+}
+func (d *tGl) GroupBaseList(status, descr bool, targ func(group []byte, status byte, descr []byte)) bool {
+	e := d.s.start(lBackend,"GroupBaseList",kv{"status":status,"descr":descr})
+	n := 0
+	ok := d.inner.GroupBaseList(status,descr,func(group []byte, st byte, ds []byte) {
+		n++
+		targ(group,st,ds)
+	})
+	d.s.done(e,kv{"ok":ok,"entries":n})
+	return ok
+}
+
+var _ gold.ArticleGroupEX = (*tAgEx)(nil)
+var _ gold.ArticleDirectEX = (*tAdEx)(nil)
+var _ gold.GroupListDB = (*tGl)(nil)
@@ -30,6 +30,8 @@ import "github.com/gocql/gocql"
 import "github.com/maxymania/fastnntp-polyglot"
 import "github.com/maxymania/fastnntp-polyglot/gold"
 import "github.com/byte-mug/golibs/msgpackx"
+import "encoding/binary"
+import "math"
 import "time"
 
 func flattenP(o *newspolyglot.ArticleOverview) []interface{} {
@@ -155,5 +157,47 @@ func (s *Storage) ArticleDirectRollback(id []byte) {
 	q.Exec()
 }
 
+/*
+Enumerates the articles in token order. The cursor is the last token seen.
+The arrival time is derived from the write time of the row.
+*/
+func (s *Storage) ArticleDirectEnum(cursor []byte, limit int, filter *gold.ArticleDirectFilter, targ func(e *gold.ArticleDirectEntry)) (next []byte, err error) {
+	if limit<=0 { limit = 1024 }
+	var q *gocql.Query
+	if len(cursor)==8 {
+		q = s.Session.Query(`
+		SELECT token(msgid),msgid,TTL(xover),WRITETIME(xover) FROM artdirtab WHERE token(msgid) > ? LIMIT ?
+		`,int64(binary.BigEndian.Uint64(cursor)),limit)
+	} else {
+		q = s.Session.Query(`
+		SELECT token(msgid),msgid,TTL(xover),WRITETIME(xover) FROM artdirtab WHERE token(msgid) >= ? LIMIT ?
+		`,int64(math.MinInt64),limit)
+	}
+	iter := qIter(q.PageSize(limit))
+	
+	var e gold.ArticleDirectEntry
+	var tok int64
+	var ttl,wt int64
+	n := 0
+	now := time.Now().Unix()
+	for iter.Scan(&tok,&e.MsgId,&ttl,&wt) {
+		e.Expires = 0
+		if ttl>0 { e.Expires = uint64(now+ttl) }
+		e.Arrived = 0
+		if wt>0 { e.Arrived = uint64(wt/1000000) } // Microseconds.
+		if filter.Match(&e) { targ(&e) }
+		e.MsgId = nil
+		ttl,wt = 0,0
+		n++
+	}
+	err = iter.Close()
+	if err!=nil { return cursor,err }
+	if n<limit { return nil,nil }
+	next = make([]byte,8)
+	binary.BigEndian.PutUint64(next,uint64(tok))
+	return
+}
+
 var _ gold.ArticleDirectEX = (*Storage)(nil)
+var _ gold.ArticleDirectEnum = (*Storage)(nil)
 
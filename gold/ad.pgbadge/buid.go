@@ -54,6 +54,9 @@ func Initialize(q IQueryable) {
 	q.Exec(`
 	CREATE INDEX msgkhbo_kttlbrin ON msgkhbo USING brin (kttl)
 	`)
+	q.Exec(`
+	CREATE INDEX msgkhbo_kover ON msgkhbo (kover)
+	`)
 	q.Prepare("msgkhbo_maintain",`
 	DELETE FROM msgkhbo WHERE kttl <= $1
 	`)
@@ -69,6 +72,18 @@ func Initialize(q IQueryable) {
 	q.Prepare("msgkhbo_insert",`
 	INSERT INTO msgkhbo (msgid,khead,kbody,kover,kttl) VALUES ($1,$2,$3,$4,$5)
 	`)
+	q.Prepare("msgkhbo_enum",`
+	SELECT msgid,kover,kttl FROM msgkhbo WHERE msgid > $1 ORDER BY msgid LIMIT $2
+	`)
+	q.Prepare("msgkhbo_fsck",`
+	SELECT msgid,khead,kbody,kover,kttl FROM msgkhbo WHERE msgid > $1 ORDER BY msgid LIMIT $2
+	`)
+	q.Prepare("msgkhbo_bykover",`
+	SELECT msgid FROM msgkhbo WHERE kover=$1
+	`)
+	q.Prepare("msgkhbo_delete",`
+	DELETE FROM msgkhbo WHERE msgid=$1 AND kover=$2
+	`)
 }
 
 func Maintainance(q IQueryable,current uint64) {
@@ -195,5 +210,35 @@ func (i *CStuff) ArticleDirectRollback(id []byte) {
 	}
 }
 
+/*
+Enumerates the articles ordered by Message-ID. The cursor is the last Message-ID seen.
+The arrival time is derived from the (time based) key of the overview record.
+*/
+func (i *CStuff) ArticleDirectEnum(cursor []byte, limit int, filter *gold.ArticleDirectFilter, targ func(e *gold.ArticleDirectEntry)) (next []byte, err error) {
+	if limit<=0 { limit = 1024 }
+	if cursor==nil { cursor = []byte{} }
+	rows,err := i.Q.Query("msgkhbo_enum",cursor,limit)
+	if err!=nil { return cursor,err }
+	defer rows.Close()
+	
+	var e gold.ArticleDirectEntry
+	var kover []byte
+	var kttl int64
+	n := 0
+	for rows.Next() {
+		if err = rows.Scan(&e.MsgId,&kover,&kttl); err!=nil { return cursor,err }
+		e.Expires = uint64(kttl)
+		e.Arrived = keyTime(kover)
+		if filter.Match(&e) { targ(&e) }
+		next = append(next[:0],e.MsgId...)
+		e.MsgId = nil
+		n++
+	}
+	if err = rows.Err(); err!=nil { return cursor,err }
+	if n<limit { return nil,nil }
+	return
+}
+
 var _ gold.ArticleDirectEX = (*CStuff)(nil)
+var _ gold.ArticleDirectEnum = (*CStuff)(nil)
 
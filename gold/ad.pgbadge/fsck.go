@@ -0,0 +1,209 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package pgbadge
+
+import (
+	"github.com/dgraph-io/badger"
+	"github.com/jackc/pgx"
+	"context"
+	"time"
+)
+
+const (
+	// A row in msgkhbo refers to Badger keys, that don't exist.
+	FsckDanglingRow = "dangling-row"
+	
+	// A Badger key is not referred to by any row in msgkhbo.
+	FsckOrphanKey = "orphan-key"
+)
+
+type FsckOptions struct {
+	// Delete dangling rows and orphan keys, instead of just reporting them.
+	Repair bool
+	
+	// Keys younger than this are skipped, as their posting might still be in
+	// progress. Defaults to 10 minutes.
+	Grace time.Duration
+	
+	// Rows/Keys per step, defaults to 1024.
+	PageSize int
+	
+	// Pause between steps, to reduce the load on a live system.
+	Pause time.Duration
+	
+	// Optional: Called for every inconsistency found.
+	OnIssue func(kind string, msgid, key []byte)
+}
+
+type FsckReport struct {
+	Rows, Keys   int64
+	DanglingRows int64
+	OrphanKeys   int64
+	Repaired     int64
+	Errors       int64
+}
+
+func (o *FsckOptions) pageSize() int {
+	if o.PageSize<=0 { return 1024 }
+	return o.PageSize
+}
+func (o *FsckOptions) grace() time.Duration {
+	if o.Grace<=0 { return 10*time.Minute }
+	return o.Grace
+}
+func (o *FsckOptions) issue(kind string, msgid, key []byte) {
+	if o.OnIssue!=nil { o.OnIssue(kind,msgid,key) }
+}
+func (o *FsckOptions) pause(ctx context.Context) error {
+	if o.Pause>0 {
+		t := time.NewTimer(o.Pause)
+		defer t.Stop()
+		select {
+		case <- ctx.Done():
+		case <- t.C:
+		}
+	}
+	return ctx.Err()
+}
+
+// Returns true, if k looks like a key generated by generate3().
+func isArticleKey(k []byte) bool {
+	if len(k)!=16+1+16 { return false }
+	switch k[16] {
+	case 'O','H','B': return keyTime(k)!=0
+	}
+	return false
+}
+
+func (i *CStuff) hasKeys(ks ...[]byte) (bool,error) {
+	txn := i.DB.NewTransaction(false)
+	defer txn.Discard()
+	for _,k := range ks {
+		_,err := txn.Get(k)
+		if err==badger.ErrKeyNotFound { return false,nil }
+		if err!=nil { return false,err }
+	}
+	return true,nil
+}
+
+/*
+Cross-checks the metadata rows in PostgreSQL against the payloads in Badger.
+
+It works in small steps (never holding a transaction for long), so it can run
+while the system is online. Expired rows (awaiting Maintainance()) are ignored.
+*/
+func (i *CStuff) Fsck(ctx context.Context, o *FsckOptions) (rep FsckReport, err error) {
+	if o==nil { o = new(FsckOptions) }
+	if err = i.fsckRows(ctx,o,&rep); err!=nil { return }
+	err = i.fsckKeys(ctx,o,&rep)
+	return
+}
+
+type fsckRow struct {
+	msgid,khead,kbody,kover []byte
+	kttl int64
+}
+
+func (i *CStuff) fsckRows(ctx context.Context, o *FsckOptions, rep *FsckReport) error {
+	cursor := []byte{}
+	rows := make([]fsckRow,0,o.pageSize())
+	for {
+		rows = rows[:0]
+		res,err := i.Q.QueryEx(ctx,"msgkhbo_fsck",nil,cursor,o.pageSize())
+		if err!=nil { return err }
+		for res.Next() {
+			var r fsckRow
+			if err = res.Scan(&r.msgid,&r.khead,&r.kbody,&r.kover,&r.kttl); err!=nil { break }
+			rows = append(rows,r)
+		}
+		if err==nil { err = res.Err() }
+		res.Close()
+		if err!=nil { return err }
+		
+		now := time.Now().Unix()
+		for _,r := range rows {
+			rep.Rows++
+			if r.kttl<=now { continue } // Expired.
+			ok,err := i.hasKeys(r.kover,r.khead,r.kbody)
+			if err!=nil { rep.Errors++; continue }
+			if ok { continue }
+			rep.DanglingRows++
+			o.issue(FsckDanglingRow,r.msgid,r.kover)
+			if !o.Repair { continue }
+			if _,err = i.Q.ExecEx(ctx,"msgkhbo_delete",nil,r.msgid,r.kover); err!=nil { rep.Errors++; continue }
+			i.deleta(r.kover,r.khead,r.kbody)
+			rep.Repaired++
+		}
+		if len(rows)<o.pageSize() { return nil }
+		cursor = rows[len(rows)-1].msgid
+		if err = o.pause(ctx); err!=nil { return err }
+	}
+}
+
+func (i *CStuff) fsckKeys(ctx context.Context, o *FsckOptions, rep *FsckReport) error {
+	var seek []byte
+	var lastBase []byte
+	lastOk := true
+	keys := make([][]byte,0,o.pageSize())
+	for {
+		keys = keys[:0]
+		txn := i.DB.NewTransaction(false)
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		for it.Seek(seek); it.Valid() && len(keys)<cap(keys) ; it.Next() {
+			keys = append(keys,it.Item().KeyCopy(nil))
+		}
+		it.Close()
+		txn.Discard()
+		
+		young := uint64(time.Now().Add(-o.grace()).Unix())
+		for _,k := range keys {
+			if !isArticleKey(k) { continue }
+			rep.Keys++
+			if keyTime(k)>young { continue }
+			
+			// The keys of an article share the first 16 bytes, and are adjacent.
+			if lastBase==nil || string(lastBase)!=string(k[:16]) {
+				kover := append([]byte(nil),k...)
+				kover[16] = 'O'
+				var msgid []byte
+				err := i.Q.QueryRowEx(ctx,"msgkhbo_bykover",nil,kover).Scan(&msgid)
+				if err!=nil && err!=pgx.ErrNoRows { rep.Errors++; lastBase = nil; continue }
+				lastBase = append(lastBase[:0],k[:16]...)
+				lastOk = err==nil
+			}
+			if lastOk { continue }
+			rep.OrphanKeys++
+			o.issue(FsckOrphanKey,nil,k)
+			if !o.Repair { continue }
+			i.deleta(k)
+			rep.Repaired++
+		}
+		if len(keys)<cap(keys) { return nil }
+		seek = append(keys[len(keys)-1],0) // Continue right after the last key.
+		if err := o.pause(ctx); err!=nil { return err }
+	}
+}
@@ -51,3 +51,19 @@ func generate3(msgid []byte) ([]byte,[]byte,[]byte) {
 	return a,b,c
 }
 
+
+// 100ns intervals between 1582-10-15 (the UUID epoch) and 1970-01-01.
+const uuidEpoch = 0x01B21DD213814000
+
+/*
+Returns the creation time (Unix time) of a key generated by generate(), or 0 if
+the key is not based on a time based UUID.
+*/
+func keyTime(k []byte) uint64 {
+	if len(k)<16 || (k[6]>>4)!=1 { return 0 }
+	ts := uint64(k[6]&0x0f)<<56 | uint64(k[7])<<48 | // time_hi
+		uint64(k[4])<<40 | uint64(k[5])<<32 | // time_mid
+		uint64(k[0])<<24 | uint64(k[1])<<16 | uint64(k[2])<<8 | uint64(k[3]) // time_low
+	if ts<uuidEpoch { return 0 }
+	return (ts-uuidEpoch)/10000000
+}
@@ -0,0 +1,74 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package pgbadge
+
+import (
+	"github.com/maxymania/fastnntp-polyglot/gold/maint"
+	"github.com/dgraph-io/badger"
+	"context"
+	"time"
+)
+
+/*
+Runs the Badger value log garbage collection, until there is nothing left to
+rewrite. If ratio is <= 0, 0.5 is used.
+*/
+func (i *CStuff) ValueLogGC(ctx context.Context, ratio float64) error {
+	if ratio<=0 { ratio = 0.5 }
+	for ctx.Err()==nil {
+		err := i.DB.RunValueLogGC(ratio)
+		if err==badger.ErrNoRewrite { return nil }
+		if err!=nil { return err }
+	}
+	return ctx.Err()
+}
+
+/*
+Returns the maintainance tasks: deleting expired rows in PostgreSQL and the
+Badger value log GC. The keys in Badger are not deleted by a task; they are
+written with ExpiresAt, so Badger hides them after expiration and drops them
+during compaction, and the value log GC reclaims the space of their values.
+*/
+func (i *CStuff) MaintainanceTasks() []*maint.Task {
+	return []*maint.Task{
+		{
+			Name: "pgbadge-expire",
+			Interval: 10*time.Minute,
+			Jitter: time.Minute,
+			Run: func(ctx context.Context) error {
+				_,err := i.Q.Exec("msgkhbo_maintain",uint64(time.Now().Unix()))
+				return err
+			},
+		},
+		{
+			Name: "pgbadge-vlog-gc",
+			Interval: 30*time.Minute,
+			Jitter: 3*time.Minute,
+			Run: func(ctx context.Context) error { return i.ValueLogGC(ctx,0.5) },
+		},
+	}
+}
+
+var _ maint.Provider = (*CStuff)(nil)
@@ -0,0 +1,63 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package cassm
+
+import "github.com/maxymania/fastnntp-polyglot/gold/maint"
+import "github.com/gocql/gocql"
+import "context"
+import "time"
+
+func ctrTableTask(session *gocql.Session) []*maint.Task {
+	return []*maint.Task{{
+		Name: "cassm-ctrtable",
+		Interval: time.Hour,
+		Jitter: 5*time.Minute,
+		Run: func(ctx context.Context) error { return maintainCtrTable(ctx,session) },
+	}}
+}
+
+// Like MaintainanceCtrTable, but reports the first error and stops, when ctx is done.
+func maintainCtrTable(ctx context.Context, session *gocql.Session) (err error) {
+	iter := session.Query(`
+		SELECT identifier,livesuntil FROM agrpcnt WHERE livesuntil < ? ALLOW FILTERING
+	`,time.Now().UTC().Unix()).WithContext(ctx).PageSize(24<<10).Iter()
+	
+	var gid gocql.UUID
+	var lives uint64
+	for err==nil && iter.Scan(&gid,&lives) {
+		err = session.Query(`DELETE FROM agrpcnt WHERE identifier = ? AND livesuntil = ?`,gid,lives).WithContext(ctx).Exec()
+	}
+	if e := iter.Close(); err==nil { err = e }
+	return
+}
+
+// Returns the maintainance task for the Countertable 'agrpcnt'.
+func (s *SimpleGroupDB) MaintainanceTasks() []*maint.Task { return ctrTableTask(s.Session) }
+
+// Returns the maintainance task for the Countertable 'agrpcnt'.
+func (s *N2LayerGroupDB) MaintainanceTasks() []*maint.Task { return ctrTableTask(s.Session) }
+
+var _ maint.Provider = (*SimpleGroupDB)(nil)
+var _ maint.Provider = (*N2LayerGroupDB)(nil)
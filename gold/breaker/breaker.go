@@ -0,0 +1,152 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+Circuit breakers for backends.
+
+A Breaker tracks the failures and the latency of the calls to one backend.
+After too many failures in a row, it opens: calls fail fast, instead of
+waiting for the driver timeout. After a while, it half-opens and lets a single
+call through to probe, whether the backend has recovered.
+*/
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrOpen = errors.New("breaker: circuit open")
+
+type State int
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+func (s State) String() string {
+	switch s {
+	case Closed: return "closed"
+	case Open: return "open"
+	case HalfOpen: return "half-open"
+	}
+	return "invalid"
+}
+
+type Config struct {
+	// Consecutive failures, that open the circuit. Defaults to 5.
+	FailureThreshold int
+	
+	// Calls, that take longer, count as failures. Defaults to 10 seconds;
+	// negative values disable this. Read calls can't report errors, so this
+	// is the only way, they open the circuit.
+	SlowCall time.Duration
+	
+	// Time the circuit stays open, before a probe is let through.
+	// Defaults to 30 seconds.
+	OpenFor time.Duration
+}
+
+type Breaker struct {
+	Name string
+	Config
+	
+	mu       sync.Mutex
+	state    State
+	fails    int
+	openedAt time.Time
+	probing  bool
+}
+
+func New(name string, cfg *Config) *Breaker {
+	b := &Breaker{Name:name}
+	if cfg!=nil { b.Config = *cfg }
+	return b
+}
+
+func (b *Breaker) threshold() int {
+	if b.FailureThreshold<=0 { return 5 }
+	return b.FailureThreshold
+}
+func (b *Breaker) slowCall() time.Duration {
+	if b.SlowCall==0 { return 10*time.Second }
+	return b.SlowCall
+}
+func (b *Breaker) openFor() time.Duration {
+	if b.OpenFor<=0 { return 30*time.Second }
+	return b.OpenFor
+}
+
+/*
+Returns true, if a call may proceed. Every allowed call must be followed by
+a call to Record().
+*/
+func (b *Breaker) Allow() bool {
+	b.mu.Lock(); defer b.mu.Unlock()
+	switch b.state {
+	case Closed: return true
+	case Open:
+		if time.Since(b.openedAt)<b.openFor() { return false }
+		b.state = HalfOpen
+		b.probing = false
+	}
+	if b.probing { return false }
+	b.probing = true
+	return true
+}
+
+/*
+Records the outcome of a call, that started at 'start'.
+*/
+func (b *Breaker) Record(start time.Time, failed bool) {
+	if d := b.slowCall(); d>0 && time.Since(start)>d { failed = true }
+	b.mu.Lock(); defer b.mu.Unlock()
+	switch b.state {
+	case HalfOpen:
+		b.probing = false
+		if failed {
+			b.state = Open
+			b.openedAt = time.Now()
+		} else {
+			b.state = Closed
+			b.fails = 0
+		}
+	case Closed:
+		if !failed { b.fails = 0; return }
+		b.fails++
+		if b.fails>=b.threshold() {
+			b.state = Open
+			b.openedAt = time.Now()
+		}
+	}
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock(); defer b.mu.Unlock()
+	return b.state
+}
+
+// Returns true, if the circuit is closed.
+func (b *Breaker) Healthy() bool { return b.State()==Closed }
@@ -0,0 +1,281 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package breaker
+
+import (
+	"github.com/maxymania/fastnntp-polyglot"
+	"github.com/maxymania/fastnntp-polyglot/gold"
+	"github.com/byte-mug/fastnntp/posting"
+	"time"
+)
+
+/*
+Decorators. Calls, that return an error, count as failed, if the error is
+non-nil. All other calls fail only, if they are slower than Config.SlowCall.
+While the circuit is open, calls return ErrOpen or a "not found" result.
+Rollbacks (GroupHeadRevert, ArticleDirectRollback) are always passed through.
+*/
+
+type GroupHeadCache struct {
+	Inner newspolyglot.GroupHeadCache
+	B *Breaker
+}
+func (d *GroupHeadCache) GroupHeadFilter(groups [][]byte) ([][]byte,error) {
+	if !d.B.Allow() { return nil,ErrOpen }
+	t := time.Now()
+	r,err := d.Inner.GroupHeadFilter(groups)
+	d.B.Record(t,err!=nil)
+	return r,err
+}
+
+type GroupHead struct {
+	Inner newspolyglot.GroupHeadDB
+	B *Breaker
+}
+func (d *GroupHead) GroupHeadInsert(groups [][]byte, buf []int64) ([]int64,error) {
+	if !d.B.Allow() { return nil,ErrOpen }
+	t := time.Now()
+	r,err := d.Inner.GroupHeadInsert(groups,buf)
+	d.B.Record(t,err!=nil)
+	return r,err
+}
+func (d *GroupHead) GroupHeadRevert(groups [][]byte, nums []int64) error {
+	// Always attempt the rollback, even if the circuit is open.
+	return d.Inner.GroupHeadRevert(groups,nums)
+}
+func (d *GroupHead) GroupHeadNeverReuse() bool {
+	m,ok := d.Inner.(newspolyglot.GroupHeadMonotonic)
+	return ok && m.GroupHeadNeverReuse()
+}
+
+/*
+Rejects postings, while the circuit of B or of any of the backends, the
+postings are written to (Depends), is not closed. ArticlePostingCheckPost
+reports false then (read-only mode).
+*/
+type ArticlePosting struct {
+	Inner newspolyglot.ArticlePostingDB
+	B *Breaker
+	Depends []*Breaker
+}
+func (d *ArticlePosting) writable() bool {
+	if !d.B.Healthy() { return false }
+	for _,b := range d.Depends {
+		if !b.Healthy() { return false }
+	}
+	return true
+}
+func (d *ArticlePosting) ArticlePostingPost(headp *posting.HeadInfo, body []byte, ngs [][]byte, numbs []int64) (rejected bool, failed bool, err error) {
+	if !d.B.Allow() { return false,true,ErrOpen }
+	t := time.Now()
+	rejected,failed,err = d.Inner.ArticlePostingPost(headp,body,ngs,numbs)
+	d.B.Record(t,err!=nil)
+	return
+}
+func (d *ArticlePosting) ArticlePostingCheckPost() (possible bool) {
+	return d.writable() && d.Inner.ArticlePostingCheckPost()
+}
+func (d *ArticlePosting) ArticlePostingCheckPostId(id []byte) (wanted bool, possible bool) {
+	if !d.writable() { return true,false }
+	return d.Inner.ArticlePostingCheckPostId(id)
+}
+
+type ArticleDirect struct {
+	Inner newspolyglot.ArticleDirectDB
+	B *Breaker
+}
+func (d *ArticleDirect) ArticleDirectStat(id []byte) bool {
+	if !d.B.Allow() { return false }
+	t := time.Now()
+	r := d.Inner.ArticleDirectStat(id)
+	d.B.Record(t,false)
+	return r
+}
+func (d *ArticleDirect) ArticleDirectGet(id []byte, head, body bool) *newspolyglot.ArticleObject {
+	if !d.B.Allow() { return nil }
+	t := time.Now()
+	r := d.Inner.ArticleDirectGet(id,head,body)
+	d.B.Record(t,false)
+	return r
+}
+func (d *ArticleDirect) ArticleDirectOverview(id []byte) *newspolyglot.ArticleOverview {
+	if !d.B.Allow() { return nil }
+	t := time.Now()
+	r := d.Inner.ArticleDirectOverview(id)
+	d.B.Record(t,false)
+	return r
+}
+
+type ArticleGroup struct {
+	Inner newspolyglot.ArticleGroupDB
+	B *Breaker
+}
+func (d *ArticleGroup) ArticleGroupStat(group []byte, num int64, id_buf []byte) ([]byte, bool) {
+	if !d.B.Allow() { return nil,false }
+	t := time.Now()
+	id,ok := d.Inner.ArticleGroupStat(group,num,id_buf)
+	d.B.Record(t,false)
+	return id,ok
+}
+func (d *ArticleGroup) ArticleGroupGet(group []byte, num int64, head, body bool, id_buf []byte) ([]byte, *newspolyglot.ArticleObject) {
+	if !d.B.Allow() { return nil,nil }
+	t := time.Now()
+	id,obj := d.Inner.ArticleGroupGet(group,num,head,body,id_buf)
+	d.B.Record(t,false)
+	return id,obj
+}
+func (d *ArticleGroup) ArticleGroupOverview(group []byte, first, last int64, targ func(int64, *newspolyglot.ArticleOverview)) {
+	if !d.B.Allow() { return }
+	t := time.Now()
+	d.Inner.ArticleGroupOverview(group,first,last,targ)
+	d.B.Record(t,false)
+}
+func (d *ArticleGroup) ArticleGroupMove(group []byte, i int64, backward bool, id_buf []byte) (ni int64, id []byte, ok bool) {
+	if !d.B.Allow() { return }
+	t := time.Now()
+	ni,id,ok = d.Inner.ArticleGroupMove(group,i,backward,id_buf)
+	d.B.Record(t,false)
+	return
+}
+func (d *ArticleGroup) ArticleGroupList(group []byte, first, last int64, targ func(int64)) {
+	if !d.B.Allow() { return }
+	t := time.Now()
+	d.Inner.ArticleGroupList(group,first,last,targ)
+	d.B.Record(t,false)
+}
+
+type GroupRealtime struct {
+	Inner newspolyglot.GroupRealtimeDB
+	B *Breaker
+}
+func (d *GroupRealtime) GroupRealtimeQuery(group []byte) (number int64, low int64, high int64, ok bool) {
+	if !d.B.Allow() { return }
+	t := time.Now()
+	number,low,high,ok = d.Inner.GroupRealtimeQuery(group)
+	d.B.Record(t,false)
+	return
+}
+func (d *GroupRealtime) GroupRealtimeList(targ func(group []byte, high, low int64, status byte)) bool {
+	if !d.B.Allow() { return false }
+	t := time.Now()
+	ok := d.Inner.GroupRealtimeList(targ)
+	d.B.Record(t,false)
+	return ok
+}
+
+type GroupStatic struct {
+	Inner newspolyglot.GroupStaticDB
+	B *Breaker
+}
+func (d *GroupStatic) GroupStaticList(targ func(group []byte, descr []byte)) bool {
+	if !d.B.Allow() { return false }
+	t := time.Now()
+	ok := d.Inner.GroupStaticList(targ)
+	d.B.Record(t,false)
+	return ok
+}
+
+/* gold */
+
+type ArticleGroupEX struct {
+	ArticleGroup
+	Inner gold.ArticleGroupEX
+}
+func NewArticleGroupEX(inner gold.ArticleGroupEX, b *Breaker) *ArticleGroupEX {
+	return &ArticleGroupEX{ArticleGroup{inner,b},inner}
+}
+func (d *ArticleGroupEX) StoreArticleInfos(groups [][]byte, nums []int64, exp uint64, ov *newspolyglot.ArticleOverview) error {
+	if !d.B.Allow() { return ErrOpen }
+	t := time.Now()
+	err := d.Inner.StoreArticleInfos(groups,nums,exp,ov)
+	d.B.Record(t,err!=nil)
+	return err
+}
+func (d *ArticleGroupEX) GroupRealtimeQuery(group []byte) (number int64, low int64, high int64, ok bool) {
+	if !d.B.Allow() { return }
+	t := time.Now()
+	number,low,high,ok = d.Inner.GroupRealtimeQuery(group)
+	d.B.Record(t,false)
+	return
+}
+
+type ArticleDirectEX struct {
+	ArticleDirect
+	Inner gold.ArticleDirectEX
+}
+func NewArticleDirectEX(inner gold.ArticleDirectEX, b *Breaker) *ArticleDirectEX {
+	return &ArticleDirectEX{ArticleDirect{inner,b},inner}
+}
+func (d *ArticleDirectEX) ArticleDirectStore(exp uint64, ov *newspolyglot.ArticleOverview, obj *newspolyglot.ArticleObject) error {
+	if !d.B.Allow() { return ErrOpen }
+	t := time.Now()
+	err := d.Inner.ArticleDirectStore(exp,ov,obj)
+	d.B.Record(t,err!=nil)
+	return err
+}
+func (d *ArticleDirectEX) ArticleDirectRollback(id []byte) {
+	// Always attempt the rollback.
+	d.Inner.ArticleDirectRollback(id)
+}
+
+// Implement gold.Unwrapper.
+func (d *GroupHeadCache) Unwrap() interface{} { return d.Inner }
+func (d *GroupHead) Unwrap() interface{} { return d.Inner }
+func (d *ArticlePosting) Unwrap() interface{} { return d.Inner }
+func (d *ArticleDirect) Unwrap() interface{} { return d.Inner }
+func (d *ArticleGroup) Unwrap() interface{} { return d.Inner }
+func (d *GroupRealtime) Unwrap() interface{} { return d.Inner }
+func (d *GroupStatic) Unwrap() interface{} { return d.Inner }
+func (d *ArticleGroupEX) Unwrap() interface{} { return d.Inner }
+func (d *ArticleDirectEX) Unwrap() interface{} { return d.Inner }
+
+// Implement gold.Rewrapper.
+func (d *ArticlePosting) Rewrap(i interface{}) interface{} { n := *d; n.Inner = i.(newspolyglot.ArticlePostingDB); return &n }
+func (d *ArticleGroup) Rewrap(i interface{}) interface{} { n := *d; n.Inner = i.(newspolyglot.ArticleGroupDB); return &n }
+func (d *GroupRealtime) Rewrap(i interface{}) interface{} { n := *d; n.Inner = i.(newspolyglot.GroupRealtimeDB); return &n }
+func (d *GroupStatic) Rewrap(i interface{}) interface{} { n := *d; n.Inner = i.(newspolyglot.GroupStaticDB); return &n }
+
+var _ newspolyglot.GroupHeadCache = (*GroupHeadCache)(nil)
+var _ newspolyglot.GroupHeadDB = (*GroupHead)(nil)
+var _ newspolyglot.ArticlePostingDB = (*ArticlePosting)(nil)
+var _ newspolyglot.ArticleDirectDB = (*ArticleDirect)(nil)
+var _ newspolyglot.ArticleGroupDB = (*ArticleGroup)(nil)
+var _ newspolyglot.GroupRealtimeDB = (*GroupRealtime)(nil)
+var _ newspolyglot.GroupStaticDB = (*GroupStatic)(nil)
+var _ gold.ArticleGroupEX = (*ArticleGroupEX)(nil)
+var _ gold.ArticleDirectEX = (*ArticleDirectEX)(nil)
+var _ gold.Unwrapper = (*GroupHeadCache)(nil)
+var _ gold.Unwrapper = (*GroupHead)(nil)
+var _ gold.Unwrapper = (*ArticlePosting)(nil)
+var _ gold.Unwrapper = (*ArticleDirect)(nil)
+var _ gold.Unwrapper = (*ArticleGroup)(nil)
+var _ gold.Unwrapper = (*GroupRealtime)(nil)
+var _ gold.Unwrapper = (*GroupStatic)(nil)
+var _ gold.Unwrapper = (*ArticleGroupEX)(nil)
+var _ gold.Unwrapper = (*ArticleDirectEX)(nil)
+var _ gold.Rewrapper = (*ArticlePosting)(nil)
+var _ gold.Rewrapper = (*ArticleGroup)(nil)
+var _ gold.Rewrapper = (*GroupRealtime)(nil)
+var _ gold.Rewrapper = (*GroupStatic)(nil)
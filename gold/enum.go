@@ -0,0 +1,93 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package gold
+
+type ArticleDirectEntry struct {
+	MsgId []byte
+	
+	// Arrival time (Unix time) or 0, if unknown.
+	Arrived uint64
+	
+	// Expiration time (Unix time) or 0, if unknown or if it never expires.
+	Expires uint64
+}
+
+/*
+Restricts an enumeration to a time window. Zero fields are unbounded.
+Entries with an unknown arrival time never match an arrival bound.
+Entries without an expiration time match ExpiresAfter, but not ExpiresBefore.
+*/
+type ArticleDirectFilter struct {
+	ArrivedAfter, ArrivedBefore uint64
+	ExpiresAfter, ExpiresBefore uint64
+}
+
+// Returns true, if the filter needs the arrival time.
+func (f *ArticleDirectFilter) NeedArrival() bool {
+	return f!=nil && (f.ArrivedAfter!=0 || f.ArrivedBefore!=0)
+}
+
+// Returns true, if the entry passes the filter. A nil filter passes everything.
+func (f *ArticleDirectFilter) Match(e *ArticleDirectEntry) bool {
+	if f==nil { return true }
+	if f.NeedArrival() {
+		if e.Arrived==0 { return false }
+		if f.ArrivedAfter!=0 && e.Arrived<f.ArrivedAfter { return false }
+		if f.ArrivedBefore!=0 && e.Arrived>=f.ArrivedBefore { return false }
+	}
+	if f.ExpiresAfter!=0 && e.Expires!=0 && e.Expires<f.ExpiresAfter { return false }
+	if f.ExpiresBefore!=0 && (e.Expires==0 || e.Expires>=f.ExpiresBefore) { return false }
+	return true
+}
+
+/*
+Optional interface implemented by ArticleDirectDB implementations, that can
+enumerate their articles.
+*/
+type ArticleDirectEnum interface {
+	/*
+	Enumerates articles following 'cursor'. An empty cursor starts at the
+	beginning. Up to 'limit' articles are examined, those matching 'filter'
+	(which may be nil) are passed to targ. The entry is only valid within the
+	callback.
+	
+	Returns the cursor to continue with, or nil if there are no more articles.
+	On error, the cursor passed in is returned, so that the page can be retried.
+	*/
+	ArticleDirectEnum(cursor []byte, limit int, filter *ArticleDirectFilter, targ func(e *ArticleDirectEntry)) (next []byte, err error)
+}
+
+/*
+Enumerates all articles in e (from 'cursor' on) page by page, stopping at the
+first error. The cursor returned can be used to resume the enumeration.
+*/
+func ArticleDirectEnumAll(e ArticleDirectEnum, cursor []byte, filter *ArticleDirectFilter, targ func(e *ArticleDirectEntry)) ([]byte,error) {
+	for {
+		next,err := e.ArticleDirectEnum(cursor,1024,filter,targ)
+		if err!=nil { return cursor,err }
+		if next==nil { return nil,nil }
+		cursor = next
+	}
+}
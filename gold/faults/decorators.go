@@ -0,0 +1,295 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package faults
+
+import (
+	"github.com/maxymania/fastnntp-polyglot"
+	"github.com/maxymania/fastnntp-polyglot/gold"
+	"github.com/maxymania/fastnntp-polyglot/postauth"
+	"github.com/byte-mug/fastnntp/posting"
+)
+
+/*
+Decorators. The rules are looked up by the name of the method.
+*/
+
+type GroupHeadCache struct {
+	Inner newspolyglot.GroupHeadCache
+	F *Injector
+}
+func (d *GroupHeadCache) GroupHeadFilter(groups [][]byte) ([][]byte,error) {
+	r,fail := d.F.fire("GroupHeadFilter")
+	if !fail { return d.Inner.GroupHeadFilter(groups) }
+	if r.After { d.Inner.GroupHeadFilter(groups) }
+	return nil,r.err()
+}
+
+type GroupHead struct {
+	Inner newspolyglot.GroupHeadDB
+	F *Injector
+}
+func (d *GroupHead) GroupHeadInsert(groups [][]byte, buf []int64) ([]int64,error) {
+	r,fail := d.F.fire("GroupHeadInsert")
+	if !fail { return d.Inner.GroupHeadInsert(groups,buf) }
+	if r.After { d.Inner.GroupHeadInsert(groups,buf) } // Leaks the numbers.
+	return nil,r.err()
+}
+func (d *GroupHead) GroupHeadRevert(groups [][]byte, nums []int64) error {
+	r,fail := d.F.fire("GroupHeadRevert")
+	if !fail { return d.Inner.GroupHeadRevert(groups,nums) }
+	if r.After { d.Inner.GroupHeadRevert(groups,nums) }
+	return r.err()
+}
+func (d *GroupHead) GroupHeadNeverReuse() bool {
+	m,ok := d.Inner.(newspolyglot.GroupHeadMonotonic)
+	return ok && m.GroupHeadNeverReuse()
+}
+
+type ArticlePosting struct {
+	Inner newspolyglot.ArticlePostingDB
+	F *Injector
+}
+func (d *ArticlePosting) ArticlePostingPost(headp *posting.HeadInfo, body []byte, ngs [][]byte, numbs []int64) (rejected bool, failed bool, err error) {
+	r,fail := d.F.fire("ArticlePostingPost")
+	if !fail { return d.Inner.ArticlePostingPost(headp,body,ngs,numbs) }
+	if r.After { d.Inner.ArticlePostingPost(headp,body,ngs,numbs) }
+	return false,true,r.err()
+}
+func (d *ArticlePosting) ArticlePostingCheckPost() (possible bool) {
+	if _,fail := d.F.fire("ArticlePostingCheckPost"); fail { return false }
+	return d.Inner.ArticlePostingCheckPost()
+}
+func (d *ArticlePosting) ArticlePostingCheckPostId(id []byte) (wanted bool, possible bool) {
+	// An unavailable backend must not make a feed believe, we had the article.
+	if _,fail := d.F.fire("ArticlePostingCheckPostId"); fail { return true,false }
+	return d.Inner.ArticlePostingCheckPostId(id)
+}
+
+type ArticleDirect struct {
+	Inner newspolyglot.ArticleDirectDB
+	F *Injector
+}
+func (d *ArticleDirect) ArticleDirectStat(id []byte) bool {
+	if _,fail := d.F.fire("ArticleDirectStat"); fail { return false }
+	return d.Inner.ArticleDirectStat(id)
+}
+func (d *ArticleDirect) ArticleDirectGet(id []byte, head, body bool) *newspolyglot.ArticleObject {
+	if _,fail := d.F.fire("ArticleDirectGet"); fail { return nil }
+	return d.Inner.ArticleDirectGet(id,head,body)
+}
+func (d *ArticleDirect) ArticleDirectOverview(id []byte) *newspolyglot.ArticleOverview {
+	if _,fail := d.F.fire("ArticleDirectOverview"); fail { return nil }
+	return d.Inner.ArticleDirectOverview(id)
+}
+
+type ArticleGroup struct {
+	Inner newspolyglot.ArticleGroupDB
+	F *Injector
+}
+func (d *ArticleGroup) ArticleGroupStat(group []byte, num int64, id_buf []byte) ([]byte, bool) {
+	if _,fail := d.F.fire("ArticleGroupStat"); fail { return nil,false }
+	return d.Inner.ArticleGroupStat(group,num,id_buf)
+}
+func (d *ArticleGroup) ArticleGroupGet(group []byte, num int64, head, body bool, id_buf []byte) ([]byte, *newspolyglot.ArticleObject) {
+	if _,fail := d.F.fire("ArticleGroupGet"); fail { return nil,nil }
+	return d.Inner.ArticleGroupGet(group,num,head,body,id_buf)
+}
+func (d *ArticleGroup) ArticleGroupOverview(group []byte, first, last int64, targ func(int64, *newspolyglot.ArticleOverview)) {
+	r,fail := d.F.fire("ArticleGroupOverview")
+	if !fail { d.Inner.ArticleGroupOverview(group,first,last,targ); return }
+	// The interface has no way to stop a scan; drop the remaining entries.
+	n := r.Truncate
+	d.Inner.ArticleGroupOverview(group,first,last,func(num int64, ov *newspolyglot.ArticleOverview) {
+		if n<=0 { return }
+		n--
+		targ(num,ov)
+	})
+}
+func (d *ArticleGroup) ArticleGroupMove(group []byte, i int64, backward bool, id_buf []byte) (ni int64, id []byte, ok bool) {
+	if _,fail := d.F.fire("ArticleGroupMove"); fail { return }
+	return d.Inner.ArticleGroupMove(group,i,backward,id_buf)
+}
+func (d *ArticleGroup) ArticleGroupList(group []byte, first, last int64, targ func(int64)) {
+	r,fail := d.F.fire("ArticleGroupList")
+	if !fail { d.Inner.ArticleGroupList(group,first,last,targ); return }
+	n := r.Truncate
+	d.Inner.ArticleGroupList(group,first,last,func(num int64) {
+		if n<=0 { return }
+		n--
+		targ(num)
+	})
+}
+
+type GroupRealtime struct {
+	Inner newspolyglot.GroupRealtimeDB
+	F *Injector
+}
+func (d *GroupRealtime) GroupRealtimeQuery(group []byte) (number int64, low int64, high int64, ok bool) {
+	if _,fail := d.F.fire("GroupRealtimeQuery"); fail { return }
+	return d.Inner.GroupRealtimeQuery(group)
+}
+func (d *GroupRealtime) GroupRealtimeList(targ func(group []byte, high, low int64, status byte)) bool {
+	r,fail := d.F.fire("GroupRealtimeList")
+	if !fail { return d.Inner.GroupRealtimeList(targ) }
+	n := r.Truncate
+	d.Inner.GroupRealtimeList(func(group []byte, high, low int64, status byte) {
+		if n<=0 { return }
+		n--
+		targ(group,high,low,status)
+	})
+	return false
+}
+
+type GroupStatic struct {
+	Inner newspolyglot.GroupStaticDB
+	F *Injector
+}
+func (d *GroupStatic) GroupStaticList(targ func(group []byte, descr []byte)) bool {
+	r,fail := d.F.fire("GroupStaticList")
+	if !fail { return d.Inner.GroupStaticList(targ) }
+	n := r.Truncate
+	d.Inner.GroupStaticList(func(group []byte, descr []byte) {
+		if n<=0 { return }
+		n--
+		targ(group,descr)
+	})
+	return false
+}
+
+/* gold */
+
+type ArticleGroupEX struct {
+	ArticleGroup
+	Inner gold.ArticleGroupEX
+}
+func NewArticleGroupEX(inner gold.ArticleGroupEX, f *Injector) *ArticleGroupEX {
+	return &ArticleGroupEX{ArticleGroup{inner,f},inner}
+}
+func (d *ArticleGroupEX) StoreArticleInfos(groups [][]byte, nums []int64, exp uint64, ov *newspolyglot.ArticleOverview) error {
+	r,fail := d.F.fire("StoreArticleInfos")
+	if !fail { return d.Inner.StoreArticleInfos(groups,nums,exp,ov) }
+	if r.After { d.Inner.StoreArticleInfos(groups,nums,exp,ov) }
+	return r.err()
+}
+func (d *ArticleGroupEX) GroupRealtimeQuery(group []byte) (number int64, low int64, high int64, ok bool) {
+	if _,fail := d.F.fire("GroupRealtimeQuery"); fail { return }
+	return d.Inner.GroupRealtimeQuery(group)
+}
+
+type ArticleDirectEX struct {
+	ArticleDirect
+	Inner gold.ArticleDirectEX
+}
+func NewArticleDirectEX(inner gold.ArticleDirectEX, f *Injector) *ArticleDirectEX {
+	return &ArticleDirectEX{ArticleDirect{inner,f},inner}
+}
+func (d *ArticleDirectEX) ArticleDirectStore(exp uint64, ov *newspolyglot.ArticleOverview, obj *newspolyglot.ArticleObject) error {
+	r,fail := d.F.fire("ArticleDirectStore")
+	if !fail { return d.Inner.ArticleDirectStore(exp,ov,obj) }
+	if r.After { d.Inner.ArticleDirectStore(exp,ov,obj) }
+	return r.err()
+}
+
+// A failing rollback is dropped, leaving an orphaned article behind.
+func (d *ArticleDirectEX) ArticleDirectRollback(id []byte) {
+	if _,fail := d.F.fire("ArticleDirectRollback"); fail { return }
+	d.Inner.ArticleDirectRollback(id)
+}
+
+type GroupList struct {
+	Inner gold.GroupListDB
+	F *Injector
+}
+func (d *GroupList) AddGroupDescr(group, descr []byte) error {
+	r,fail := d.F.fire("AddGroupDescr")
+	if !fail { return d.Inner.AddGroupDescr(group,descr) }
+	if r.After { d.Inner.AddGroupDescr(group,descr) }
+	return r.err()
+}
+func (d *GroupList) AddGroupStatus(group []byte, status byte) error {
+	r,fail := d.F.fire("AddGroupStatus")
+	if !fail { return d.Inner.AddGroupStatus(group,status) }
+	if r.After { d.Inner.AddGroupStatus(group,status) }
+	return r.err()
+}
+func (d *GroupList) GroupHeadFilterWithAuth(rank postauth.AuthRank, groups [][]byte) ([][]byte, error) {
+	r,fail := d.F.fire("GroupHeadFilterWithAuth")
+	if !fail { return d.Inner.GroupHeadFilterWithAuth(rank,groups) }
+	return nil,r.err()
+}
+func (d *GroupList) GroupBaseList(status, descr bool, targ func(group []byte, status byte, descr []byte)) bool {
+	r,fail := d.F.fire("GroupBaseList")
+	if !fail { return d.Inner.GroupBaseList(status,descr,targ) }
+	n := r.Truncate
+	d.Inner.GroupBaseList(status,descr,func(group []byte, st byte, ds []byte) {
+		if n<=0 { return }
+		n--
+		targ(group,st,ds)
+	})
+	return false
+}
+
+// Implement gold.Unwrapper.
+func (d *GroupHeadCache) Unwrap() interface{} { return d.Inner }
+func (d *GroupHead) Unwrap() interface{} { return d.Inner }
+func (d *ArticlePosting) Unwrap() interface{} { return d.Inner }
+func (d *ArticleDirect) Unwrap() interface{} { return d.Inner }
+func (d *ArticleGroup) Unwrap() interface{} { return d.Inner }
+func (d *GroupRealtime) Unwrap() interface{} { return d.Inner }
+func (d *GroupStatic) Unwrap() interface{} { return d.Inner }
+func (d *ArticleGroupEX) Unwrap() interface{} { return d.Inner }
+func (d *ArticleDirectEX) Unwrap() interface{} { return d.Inner }
+func (d *GroupList) Unwrap() interface{} { return d.Inner }
+
+// Implement gold.Rewrapper.
+func (d *ArticlePosting) Rewrap(i interface{}) interface{} { n := *d; n.Inner = i.(newspolyglot.ArticlePostingDB); return &n }
+func (d *ArticleGroup) Rewrap(i interface{}) interface{} { n := *d; n.Inner = i.(newspolyglot.ArticleGroupDB); return &n }
+func (d *GroupRealtime) Rewrap(i interface{}) interface{} { n := *d; n.Inner = i.(newspolyglot.GroupRealtimeDB); return &n }
+func (d *GroupStatic) Rewrap(i interface{}) interface{} { n := *d; n.Inner = i.(newspolyglot.GroupStaticDB); return &n }
+
+var _ newspolyglot.GroupHeadCache = (*GroupHeadCache)(nil)
+var _ newspolyglot.GroupHeadDB = (*GroupHead)(nil)
+var _ newspolyglot.ArticlePostingDB = (*ArticlePosting)(nil)
+var _ newspolyglot.ArticleDirectDB = (*ArticleDirect)(nil)
+var _ newspolyglot.ArticleGroupDB = (*ArticleGroup)(nil)
+var _ newspolyglot.GroupRealtimeDB = (*GroupRealtime)(nil)
+var _ newspolyglot.GroupStaticDB = (*GroupStatic)(nil)
+var _ gold.ArticleGroupEX = (*ArticleGroupEX)(nil)
+var _ gold.ArticleDirectEX = (*ArticleDirectEX)(nil)
+var _ gold.GroupListDB = (*GroupList)(nil)
+var _ gold.Unwrapper = (*GroupHeadCache)(nil)
+var _ gold.Unwrapper = (*GroupHead)(nil)
+var _ gold.Unwrapper = (*ArticlePosting)(nil)
+var _ gold.Unwrapper = (*ArticleDirect)(nil)
+var _ gold.Unwrapper = (*ArticleGroup)(nil)
+var _ gold.Unwrapper = (*GroupRealtime)(nil)
+var _ gold.Unwrapper = (*GroupStatic)(nil)
+var _ gold.Unwrapper = (*ArticleGroupEX)(nil)
+var _ gold.Unwrapper = (*ArticleDirectEX)(nil)
+var _ gold.Unwrapper = (*GroupList)(nil)
+var _ gold.Rewrapper = (*ArticlePosting)(nil)
+var _ gold.Rewrapper = (*ArticleGroup)(nil)
+var _ gold.Rewrapper = (*GroupRealtime)(nil)
+var _ gold.Rewrapper = (*GroupStatic)(nil)
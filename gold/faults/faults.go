@@ -0,0 +1,159 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+Fault-injection decorators for resilience testing.
+
+An Injector holds one Rule per method name (eg. "StoreArticleInfos"). The
+decorators in this package consult the Injector on every call and inject
+latency, errors, "not found" results or truncated scans accordingly.
+Methods, that can not return an error, fail by returning their "not found"
+result (nil, false).
+
+A failure of StoreArticleInfos (ArticleGroupEX) occurs after
+ArticleDirectStore succeeded, which exercises the rollback path of
+gold.PostingImpl. Rule.After lets the inner call complete before the error
+is returned, simulating a write that succeeded but whose acknowledgement got
+lost.
+
+	f := faults.New(1)
+	f.Set("StoreArticleInfos",faults.Rule{Every:2})
+	f.Set("ArticleGroupOverview",faults.Rule{Rate:0.1,Truncate:5})
+	f.Set("*",faults.Rule{Latency:20*time.Millisecond,Jitter:10*time.Millisecond})
+	setup.SetupFaults(c,f)
+*/
+package faults
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// The default error returned by injected failures.
+var ErrInjected = errors.New("faults: injected failure")
+
+type Rule struct {
+	// Probability of a failure in [0,1].
+	Rate float64
+	
+	// If > 0, every n-th call fails (in addition to Rate).
+	Every uint64
+	
+	// Latency, that is added to every call, plus a random amount up to Jitter.
+	Latency, Jitter time.Duration
+	
+	// If true, a failing call is still passed to the inner backend before the
+	// error is returned. Only for methods, that return an error.
+	After bool
+	
+	// Number of entries, a failing scan (Overview, List) delivers, before it stops.
+	Truncate int
+	
+	// Error returned by failing calls. Defaults to ErrInjected.
+	Err error
+}
+
+/*
+Decides, which calls fail. Safe for concurrent use.
+The rule "*" applies to all methods without their own rule.
+*/
+type Injector struct {
+	mu       sync.Mutex
+	rnd      *rand.Rand
+	rules    map[string]*Rule
+	calls    map[string]uint64
+	injected map[string]uint64
+	disabled bool
+}
+
+// Creates an Injector. The seed makes random failures reproducible.
+func New(seed int64) *Injector {
+	return &Injector{
+		rnd:      rand.New(rand.NewSource(seed)),
+		rules:    make(map[string]*Rule),
+		calls:    make(map[string]uint64),
+		injected: make(map[string]uint64),
+	}
+}
+
+// Sets the rule for a method.
+func (i *Injector) Set(method string, r Rule) {
+	i.mu.Lock(); defer i.mu.Unlock()
+	i.rules[method] = &r
+	i.calls[method] = 0
+}
+
+// Removes the rule for a method.
+func (i *Injector) Clear(method string) {
+	i.mu.Lock(); defer i.mu.Unlock()
+	delete(i.rules,method)
+}
+
+// Turns off (or on again) all rules, without removing them.
+func (i *Injector) Disable(off bool) {
+	i.mu.Lock(); defer i.mu.Unlock()
+	i.disabled = off
+}
+
+// Returns the number of failures injected into a method.
+func (i *Injector) Injected(method string) uint64 {
+	i.mu.Lock(); defer i.mu.Unlock()
+	return i.injected[method]
+}
+
+// Resets the call and failure counters.
+func (i *Injector) Reset() {
+	i.mu.Lock(); defer i.mu.Unlock()
+	i.calls = make(map[string]uint64)
+	i.injected = make(map[string]uint64)
+}
+
+/*
+Applies the rule of a method: sleeps for the latency and decides, whether
+the call fails. A nil Injector never fails.
+*/
+func (i *Injector) fire(method string) (r *Rule, fail bool) {
+	if i==nil { return nil,false }
+	i.mu.Lock()
+	if i.disabled { i.mu.Unlock(); return nil,false }
+	r = i.rules[method]
+	if r==nil { r = i.rules["*"] }
+	if r==nil { i.mu.Unlock(); return nil,false }
+	i.calls[method]++
+	fail = r.Every>0 && (i.calls[method]%r.Every)==0
+	if !fail && r.Rate>0 { fail = i.rnd.Float64()<r.Rate }
+	d := r.Latency
+	if r.Jitter>0 { d += time.Duration(i.rnd.Int63n(int64(r.Jitter))) }
+	if fail { i.injected[method]++ }
+	i.mu.Unlock()
+	if d>0 { time.Sleep(d) }
+	return
+}
+
+func (r *Rule) err() error {
+	if r.Err!=nil { return r.Err }
+	return ErrInjected
+}
@@ -24,6 +24,9 @@ SOFTWARE.
 
 /*
 Blue - In-Memory sequence using Apache Cassandra to record all changes.
+
+For clusters, where multiple nodes allocate numbers, use NewClusterRequester,
+which allocates with lightweight transactions instead.
 */
 package blue
 
@@ -0,0 +1,166 @@
+/*
+MIT License
+
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package blue
+
+import "github.com/gocql/gocql"
+import "github.com/maxymania/fastnntp-polyglot"
+import "github.com/maxymania/fastnntp-polyglot/gold/gh.generic"
+import "errors"
+
+var ErrContention = errors.New("grouphead: too much contention")
+
+/*
+A generic.BulkAllocator on the grouphead table, that is safe to be used by
+multiple nodes at once. Every change is a lightweight transaction, that is
+conditional on the state it was derived from.
+
+As in the in-memory sequence, headgrp holds the next number to be issued, and
+freelst the numbers, that have been released.
+*/
+type CassBulkAllocator struct {
+	Session *gocql.Session
+	
+	// Maximum number of attempts per call, if the lightweight transactions
+	// are not applied due to concurrent changes. Defaults to 16.
+	MaxRetries int
+	
+	// If true, released numbers are discarded instead of being reused.
+	NeverReuse bool
+}
+
+// Implements generic.MonotonicAllocator.
+func (c *CassBulkAllocator) AllocatorNeverReuse() bool { return c.NeverReuse }
+
+func (c *CassBulkAllocator) retries() int {
+	if c.MaxRetries<1 { return 16 }
+	return c.MaxRetries
+}
+
+func (c *CassBulkAllocator) read(group []byte) (fl []int64, hg int64, exists bool, err error) {
+	iter := c.Session.Query(`
+	SELECT freelst,headgrp FROM grouphead WHERE groupname=?
+	`,group).Consistency(gocql.Serial).Iter()
+	exists = iter.Scan(&fl,&hg)
+	err = iter.Close()
+	return
+}
+
+func (c *CassBulkAllocator) AllocIds(group []byte, buf []uint64) ([]uint64, error) {
+	for n := c.retries() ; n>0 ; n-- {
+		fl,hg,exists,err := c.read(group)
+		if err!=nil { return nil,err }
+		
+		if !exists {
+			for i := range buf { buf[i] = uint64(i+1) }
+			applied,err := c.Session.Query(`
+			INSERT INTO grouphead (groupname,headgrp) VALUES (?,?) IF NOT EXISTS
+			`,group,int64(len(buf)+1)).MapScanCAS(make(map[string]interface{}))
+			if err!=nil { return nil,err }
+			if applied { return buf,nil }
+			continue
+		}
+		if hg<1 { hg = 1 }
+		
+		// Reuse released numbers first (the set is sorted).
+		i := 0
+		for ; i<len(buf) && i<len(fl) && !c.NeverReuse ; i++ { buf[i] = uint64(fl[i]) }
+		used := fl[:i]
+		nhg := hg
+		for ; i<len(buf) ; i++ {
+			buf[i] = uint64(nhg)
+			nhg++
+		}
+		
+		var cond interface{}
+		if len(fl)>0 { cond = fl } // An empty set is null.
+		applied,err := c.Session.Query(`
+		UPDATE grouphead SET freelst = freelst - ?, headgrp = ? WHERE groupname = ?
+		IF headgrp = ? AND freelst = ?
+		`,used,nhg,group,hg,cond).MapScanCAS(make(map[string]interface{}))
+		if err!=nil { return nil,err }
+		if applied { return buf,nil }
+	}
+	return nil,ErrContention
+}
+
+func (c *CassBulkAllocator) RevertIds(group []byte, buf []uint64) error {
+	if c.NeverReuse { return nil }
+	lst := make([]int64,len(buf))
+	for i,n := range buf { lst[i] = int64(n) }
+	
+	// This is a lightweight transaction as well, because plain writes and
+	// lightweight transactions must not be mixed on the same partition.
+	_,err := c.Session.Query(`
+	UPDATE grouphead SET freelst = freelst + ? WHERE groupname = ? IF EXISTS
+	`,lst,group).MapScanCAS(make(map[string]interface{}))
+	return err
+}
+
+func (c *CassBulkAllocator) AdvanceIds(group []byte, num uint64) error {
+	for n := c.retries() ; n>0 ; n-- {
+		fl,hg,exists,err := c.read(group)
+		if err!=nil { return err }
+		
+		if !exists {
+			applied,err := c.Session.Query(`
+			INSERT INTO grouphead (groupname,headgrp) VALUES (?,?) IF NOT EXISTS
+			`,group,int64(num+1)).MapScanCAS(make(map[string]interface{}))
+			if err!=nil { return err }
+			if applied { return nil }
+			continue
+		}
+		nhg := hg
+		if nhg<=int64(num) { nhg = int64(num+1) }
+		
+		// Drop released numbers, that may be in use now (the set is sorted).
+		i := 0
+		for i<len(fl) && fl[i]<=int64(num) { i++ }
+		if nhg==hg && i==0 { return nil }
+		
+		var cond interface{}
+		if len(fl)>0 { cond = fl } // An empty set is null.
+		applied,err := c.Session.Query(`
+		UPDATE grouphead SET freelst = freelst - ?, headgrp = ? WHERE groupname = ?
+		IF headgrp = ? AND freelst = ?
+		`,fl[:i],nhg,group,hg,cond).MapScanCAS(make(map[string]interface{}))
+		if err!=nil { return err }
+		if applied { return nil }
+	}
+	return ErrContention
+}
+
+/*
+Returns a Requester, that batches the Requests per group and allocates them
+using a CassBulkAllocator. Unlike NewRequester, it does not keep the sequence
+in memory, and thus can be used by many nodes at once.
+*/
+func NewClusterRequester(s *gocql.Session, requestsPerGroup int) Requester {
+	return generic.NewRequester(&CassBulkAllocator{Session:s},requestsPerGroup)
+}
+
+var _ generic.BulkAllocator = (*CassBulkAllocator)(nil)
+var _ generic.MonotonicAllocator = (*CassBulkAllocator)(nil)
+var _ generic.AdvancingAllocator = (*CassBulkAllocator)(nil)
+var _ newspolyglot.GroupHeadDB = (*Frontend)(nil)
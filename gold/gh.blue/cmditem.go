@@ -27,16 +27,12 @@ package blue
 import rb "github.com/emirpasic/gods/trees/redblacktree"
 import "github.com/emirpasic/gods/utils"
 import "github.com/gocql/gocql"
+import "github.com/maxymania/fastnntp-polyglot/gold/gh.generic"
 import "sync"
 //import "sort"
 
-type Request struct{
-	IsRollback bool
-	Group []byte
-	Number uint64
-	Err error
-	WG sync.WaitGroup
-}
+// Identical to generic.Request, so that Frontend accepts generic Requesters.
+type Request = generic.Request
 
 type perGroup struct{
 	// Init from outside
@@ -207,9 +203,8 @@ func (g *global) Offer(p *Request) (err error) {
 	return
 }
 
-type Requester interface {
-	Offer(p *Request) (err error)
-}
+// Identical to generic.Requester.
+type Requester = generic.Requester
 func NewRequester(s *gocql.Session) Requester {
 	g := &global{session:s}
 	g.init()
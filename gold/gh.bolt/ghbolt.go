@@ -0,0 +1,149 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+Group head sequences in an embedded bolt database, for single-node deployments.
+
+Use it with gh.generic:
+	generic.NewRequester(&ghbolt.BoltBulkAllocator{DB: db},0)
+*/
+package ghbolt
+
+import "github.com/boltdb/bolt"
+import "github.com/maxymania/fastnntp-polyglot/gold/gh.generic"
+import "encoding/binary"
+import "sort"
+
+var bGroupheads = []byte("groupheads")
+
+/*
+A generic.BulkAllocator, that stores the counter and the free list of every
+group in a bolt database. Every AllocIds/RevertIds call is one transaction,
+which is synced to disk before the numbers are handed out, so no number is
+issued twice, even after a crash.
+
+Record layout: 8 bytes counter (the highest number issued), followed by the
+free list as sorted 8-byte numbers (all big-endian).
+*/
+type BoltBulkAllocator struct {
+	DB *bolt.DB
+	
+	// If true, released numbers are discarded instead of being reused.
+	NeverReuse bool
+}
+
+// Implements generic.MonotonicAllocator.
+func (b *BoltBulkAllocator) AllocatorNeverReuse() bool { return b.NeverReuse }
+
+func (b *BoltBulkAllocator) Init() error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		_,err := tx.CreateBucketIfNotExists(bGroupheads)
+		return err
+	})
+}
+
+func decode(v []byte) (ctr uint64, free []uint64) {
+	if len(v)<8 { return }
+	ctr = binary.BigEndian.Uint64(v)
+	v = v[8:]
+	free = make([]uint64,len(v)/8)
+	for i := range free { free[i] = binary.BigEndian.Uint64(v[i*8:]) }
+	return
+}
+func encode(ctr uint64, free []uint64) []byte {
+	v := make([]byte,8+8*len(free))
+	binary.BigEndian.PutUint64(v,ctr)
+	for i,n := range free { binary.BigEndian.PutUint64(v[8+i*8:],n) }
+	return v
+}
+
+func bucket(tx *bolt.Tx) (*bolt.Bucket,error) {
+	bkt := tx.Bucket(bGroupheads)
+	if bkt!=nil { return bkt,nil }
+	return tx.CreateBucket(bGroupheads)
+}
+
+func (b *BoltBulkAllocator) AllocIds(group []byte, buf []uint64) (res []uint64, err error) {
+	err = b.DB.Update(func(tx *bolt.Tx) error {
+		bkt,err := bucket(tx)
+		if err!=nil { return err }
+		ctr,free := decode(bkt.Get(group))
+		
+		// Reuse released numbers first.
+		n := 0
+		if !b.NeverReuse {
+			n = copy(buf,free)
+			free = free[n:]
+		}
+		for i := n ; i<len(buf) ; i++ {
+			ctr++
+			buf[i] = ctr
+		}
+		return bkt.Put(group,encode(ctr,free))
+	})
+	if err!=nil { return nil,err }
+	return buf,nil
+}
+
+func (b *BoltBulkAllocator) RevertIds(group []byte, buf []uint64) error {
+	if b.NeverReuse { return nil }
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		bkt,err := bucket(tx)
+		if err!=nil { return err }
+		ctr,free := decode(bkt.Get(group))
+		
+		for _,n := range buf {
+			if n==0 || n>ctr { continue } // Never issued.
+			free = append(free,n)
+		}
+		sort.Slice(free,func(i,j int) bool { return free[i]<free[j] })
+		
+		// Remove duplicates.
+		j := 0
+		for i,n := range free {
+			if i>0 && n==free[j-1] { continue }
+			free[j] = n
+			j++
+		}
+		return bkt.Put(group,encode(ctr,free[:j]))
+	})
+}
+
+func (b *BoltBulkAllocator) AdvanceIds(group []byte, num uint64) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		bkt,err := bucket(tx)
+		if err!=nil { return err }
+		ctr,free := decode(bkt.Get(group))
+		if ctr<num { ctr = num }
+		
+		// Drop released numbers, that may be in use now.
+		i := 0
+		for i<len(free) && free[i]<=num { i++ }
+		return bkt.Put(group,encode(ctr,free[i:]))
+	})
+}
+
+var _ generic.BulkAllocator = (*BoltBulkAllocator)(nil)
+var _ generic.AdvancingAllocator = (*BoltBulkAllocator)(nil)
+var _ generic.MonotonicAllocator = (*BoltBulkAllocator)(nil)
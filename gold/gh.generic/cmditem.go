@@ -24,61 +24,140 @@ SOFTWARE.
 
 package generic
 
+import "context"
+import "errors"
 import "sync"
+import "sync/atomic"
+import "time"
+
+var ErrClosed = errors.New("requester closed")
+var ErrNotSupported = errors.New("not supported by the allocator")
 
 type BulkAllocator interface{
 	AllocIds(group []byte,buf []uint64) ([]uint64,error)
 	RevertIds(group []byte,buf []uint64) (error)
 }
 
+/*
+Optional interface of a BulkAllocator. AllocatorNeverReuse returns true, if
+AllocIds never hands out a number twice, even after RevertIds (for example,
+because the free list is disabled).
+*/
+type MonotonicAllocator interface{
+	AllocatorNeverReuse() bool
+}
+/*
+Optional interface of a BulkAllocator. AdvanceIds raises the counter of the
+group to at least num, so that AllocIds never returns num or a lower number
+afterwards. Released numbers up to num are removed from the free list.
+*/
+type AdvancingAllocator interface{
+	AdvanceIds(group []byte,num uint64) error
+}
+
+func allocatorNeverReuse(s BulkAllocator) bool {
+	ma,ok := s.(MonotonicAllocator)
+	return ok && ma.AllocatorNeverReuse()
+}
+
+type Options struct{
+	// Maximum number of Requests per batch and per group queue. Defaults to 128.
+	RequestsPerGroup int
+	
+	// Per-group state that has been idle this long is evicted. Defaults to
+	// 5 minutes; negative values disable eviction. The idle groups are looked
+	// for every IdleTimeout/2, but at most every 10 milliseconds.
+	IdleTimeout time.Duration
+	
+	// If >0, a fixed pool of Workers goroutines serves all groups. Otherwise
+	// every active group gets its own goroutine.
+	Workers int
+	
+	// If true, Rollback Requests are acknowledged without calling RevertIds
+	// and their numbers are not handed to other Requests. The Requester only
+	// reports, that numbers are never reused, if the BulkAllocator implements
+	// MonotonicAllocator as well, since an allocator with a free list may
+	// still hand out numbers, that were released earlier.
+	// Implied by a MonotonicAllocator.
+	NeverReuse bool
+}
 
 type perGroup struct{
 	// Init from outside
 	session BulkAllocator
 	group []byte
 	rpgsize int // Requests Per Group Size
+	neverReuse bool
 	
 	// Init from inside
 	stream chan *Request
 	rb,al []*Request
 	buf1  []uint64
+	
+	refs      int32 // Offers in progress.
+	pending   int32 // Requests queued or being served.
+	scheduled int32 // Pool mode: 1, if in the ready queue or being served.
+	lastUsed  int64 // Unix nanoseconds.
 }
-func (p *perGroup) init() (err error) {
+func (p *perGroup) init() {
 	p.stream = make(chan *Request,p.rpgsize)
 	p.rb = make([]*Request,0,p.rpgsize)
 	p.al = make([]*Request,0,p.rpgsize)
 	p.buf1 = make([]uint64,0,p.rpgsize)
-	
-	go p.reqloop()
-	return
+	p.touch()
+}
+func (p *perGroup) touch() {
+	atomic.StoreInt64(&p.lastUsed,time.Now().UnixNano())
+}
+func (p *perGroup) idle(deadline int64) bool {
+	return atomic.LoadInt32(&p.refs)==0 &&
+		atomic.LoadInt32(&p.pending)==0 &&
+		atomic.LoadInt32(&p.scheduled)==0 &&
+		len(p.stream)==0 &&
+		atomic.LoadInt64(&p.lastUsed)<deadline
 }
-func (p *perGroup) reqloop() {
+
+// Dedicated mode: runs until the stream is closed.
+func (p *perGroup) reqloop(wg *sync.WaitGroup) {
+	defer wg.Done()
 	for {
-		i := 0
-		rb := p.rb
-		al := p.al
-		for {
-			var r *Request
-			if i==0 {
-				r = <- p.stream
-			} else if i<p.rpgsize {
-				select {
-				case r = <- p.stream:
-				default: goto done
-				}
-			} else { goto done }
-			i++
-			if r.IsRollback {
-				rb = append(rb,r)
-			} else {
-				al = append(al,r)
-			}
+		r,ok := <- p.stream
+		if !ok { return }
+		p.batch(r)
+	}
+}
+
+// Collects up to rpgsize Requests, starting with r, and performs them.
+func (p *perGroup) batch(r *Request) {
+	rb := p.rb
+	al := p.al
+	for i := 0 ; r!=nil ; i++ {
+		if r.IsRollback {
+			rb = append(rb,r)
+		} else {
+			al = append(al,r)
+		}
+		r = nil
+		if i+1>=p.rpgsize { break }
+		select {
+		case r = <- p.stream:
+		default:
 		}
-	done:
-		p.perform(rb,al)
 	}
+	n := len(rb)+len(al)
+	p.perform(rb,al)
+	p.touch()
+	atomic.AddInt32(&p.pending,int32(-n))
 }
 func (p *perGroup) perform(rb,al []*Request) {
+	if p.neverReuse {
+		for _,rbo := range rb {
+			rbo.Err = nil
+			rbo.WG.Done()
+		}
+		rb = rb[:0]
+	}
+	
 	// Step 1: Shortcut the ids.
 	nkeys := p.buf1
 	rbi,rbn := 0,len(rb)
@@ -129,49 +208,223 @@ type global struct{
 	// Init from outside
 	session BulkAllocator
 	rpgsize int // Requests Per Group Size
+	idle    time.Duration
+	workers int
+	neverReuse bool
 	
 	// Init from inside
 	groups map[string]*perGroup
+	closed bool
+	inflight sync.WaitGroup // Offers in progress.
+	running  sync.WaitGroup // Goroutines.
+	stop     chan struct{}
+	
+	// Pool mode: the ready queue.
+	rmu     sync.Mutex
+	rcond   *sync.Cond
+	ready   []*perGroup
+	closing bool
 }
 func (g *global) init() {
 	if g.rpgsize<1 { g.rpgsize = 128 }
+	if g.idle==0 { g.idle = 5*time.Minute }
 	g.groups = make(map[string]*perGroup)
+	g.stop = make(chan struct{})
+	g.rcond = sync.NewCond(&g.rmu)
+	for i := 0 ; i<g.workers ; i++ {
+		g.running.Add(1)
+		go g.worker()
+	}
+	if g.idle>0 {
+		g.running.Add(1)
+		go g.janitor()
+	}
 }
-func (g *global) lookup(grp []byte) *perGroup {
-	g.RLock(); defer g.RUnlock()
-	return g.groups[string(grp)]
-}
-func (g *global) instantiate(grp []byte) (pgr *perGroup,err error) {
+
+// Looks up (or creates) the perGroup, increments its reference counter and
+// marks it as used.
+func (g *global) acquire(grp []byte) (pgr *perGroup,err error) {
+	g.RLock()
+	if g.closed { g.RUnlock(); return nil,ErrClosed }
+	pgr = g.groups[string(grp)]
+	if pgr!=nil {
+		atomic.AddInt32(&pgr.refs,1)
+		g.inflight.Add(1)
+		pgr.touch()
+	}
+	g.RUnlock()
+	if pgr!=nil { return }
+	
 	g.Lock(); defer g.Unlock()
+	if g.closed { return nil,ErrClosed }
 	pgr = g.groups[string(grp)]
 	if pgr==nil {
 		gc := make([]byte,len(grp))
 		copy(gc,grp)
-		pgr = &perGroup{session:g.session,group:gc,rpgsize:g.rpgsize}
-		err = pgr.init()
-		if err==nil {
-			g.groups[string(gc)] = pgr
+		pgr = &perGroup{session:g.session,group:gc,rpgsize:g.rpgsize,neverReuse:g.neverReuse}
+		pgr.init()
+		g.groups[string(gc)] = pgr
+		if g.workers<1 {
+			g.running.Add(1)
+			go pgr.reqloop(&g.running)
 		}
 	}
+	atomic.AddInt32(&pgr.refs,1)
+	g.inflight.Add(1)
+	pgr.touch()
 	return
 }
+func (g *global) release(pgr *perGroup) {
+	atomic.AddInt32(&pgr.refs,-1)
+	g.inflight.Done()
+}
+
 func (g *global) Offer(p *Request) (err error) {
-	pgr := g.lookup(p.Group)
-	if pgr==nil {
-		pgr,err = g.instantiate(p.Group)
-	}
+	return g.OfferContext(context.Background(),p)
+}
+
+/*
+Like Offer, but gives up, if ctx is done before the Request could be queued.
+*/
+func (g *global) OfferContext(ctx context.Context, p *Request) (err error) {
+	pgr,err := g.acquire(p.Group)
 	if err!=nil { return }
-	pgr.stream <- p
+	defer g.release(pgr)
+	atomic.AddInt32(&pgr.pending,1)
+	select {
+	case pgr.stream <- p:
+	case <- ctx.Done():
+		atomic.AddInt32(&pgr.pending,-1)
+		return ctx.Err()
+	}
+	if g.workers>0 { g.schedule(pgr) }
 	return
 }
 
+func (g *global) schedule(pgr *perGroup) {
+	if !atomic.CompareAndSwapInt32(&pgr.scheduled,0,1) { return }
+	g.rmu.Lock()
+	g.ready = append(g.ready,pgr)
+	g.rmu.Unlock()
+	g.rcond.Signal()
+}
+func (g *global) worker() {
+	defer g.running.Done()
+	for {
+		g.rmu.Lock()
+		for len(g.ready)==0 && !g.closing { g.rcond.Wait() }
+		if len(g.ready)==0 { g.rmu.Unlock(); return }
+		pgr := g.ready[0]
+		g.ready[0] = nil
+		g.ready = g.ready[1:]
+		g.rmu.Unlock()
+		
+		select {
+		case r,ok := <- pgr.stream:
+			if ok { pgr.batch(r) }
+		default:
+		}
+		atomic.StoreInt32(&pgr.scheduled,0)
+		if len(pgr.stream)>0 { g.schedule(pgr) }
+	}
+}
+
+// Evicts idle groups.
+func (g *global) janitor() {
+	defer g.running.Done()
+	d := g.idle/2
+	if d<10*time.Millisecond { d = 10*time.Millisecond }
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <- g.stop: return
+		case now := <- t.C:
+			deadline := now.Add(-g.idle).UnixNano()
+			g.Lock()
+			for k,pgr := range g.groups {
+				if !pgr.idle(deadline) { continue }
+				delete(g.groups,k)
+				close(pgr.stream)
+			}
+			g.Unlock()
+		}
+	}
+}
+
+// Implements AdvancingAllocator, if the BulkAllocator does.
+func (g *global) AdvanceIds(group []byte,num uint64) error {
+	aa,ok := g.session.(AdvancingAllocator)
+	if !ok { return ErrNotSupported }
+	return aa.AdvanceIds(group,num)
+}
+
+// Implement gold.Unwrapper.
+func (g *global) Unwrap() interface{} { return g.session }
+
+// Returns true, if the BulkAllocator is a MonotonicAllocator, that never
+// reuses numbers.
+func (g *global) NeverReuse() bool { return g.neverReuse && allocatorNeverReuse(g.session) }
+
+/*
+Stops accepting new Requests, serves all queued Requests and stops all
+goroutines.
+*/
+func (g *global) Close() error {
+	return g.CloseContext(context.Background())
+}
+
+/*
+Like Close, but returns ctx.Err(), if the draining takes longer than ctx
+permits. The draining continues in the background, anyway.
+*/
+func (g *global) CloseContext(ctx context.Context) error {
+	g.Lock()
+	if g.closed { g.Unlock(); return ErrClosed }
+	g.closed = true
+	g.Unlock()
+	
+	done := make(chan struct{})
+	go func() {
+		g.inflight.Wait()
+		close(g.stop)
+		g.Lock()
+		for k,pgr := range g.groups {
+			delete(g.groups,k)
+			close(pgr.stream)
+		}
+		g.Unlock()
+		g.rmu.Lock()
+		g.closing = true
+		g.rmu.Unlock()
+		g.rcond.Broadcast()
+		g.running.Wait()
+		close(done)
+	}()
+	select {
+	case <- done: return nil
+	case <- ctx.Done(): return ctx.Err()
+	}
+}
+
+/*
+Requester that can be shut down.
+*/
+type Service interface{
+	Requester
+	ContextRequester
+	Close() error
+	CloseContext(ctx context.Context) error
+}
+
 func NewRequesterSimple(s BulkAllocator) Requester {
-	g := &global{session:s}
-	g.init()
-	return g
+	return NewRequesterOptions(s,Options{})
 }
 func NewRequester(s BulkAllocator,requestsPerGroup int) Requester {
-	g := &global{session:s,rpgsize:requestsPerGroup}
+	return NewRequesterOptions(s,Options{RequestsPerGroup:requestsPerGroup})
+}
+func NewRequesterOptions(s BulkAllocator,o Options) Service {
+	g := &global{session:s,rpgsize:o.RequestsPerGroup,idle:o.IdleTimeout,workers:o.Workers,neverReuse:o.NeverReuse||allocatorNeverReuse(s)}
 	g.init()
 	return g
 }
@@ -0,0 +1,129 @@
+/*
+MIT License
+
+Copyright (c) 2018-2020 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package generic
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeAllocator struct {
+	mu   sync.Mutex
+	ctrs map[string]uint64
+}
+func (a *fakeAllocator) AllocIds(group []byte,buf []uint64) ([]uint64,error) {
+	a.mu.Lock(); defer a.mu.Unlock()
+	for i := range buf {
+		a.ctrs[string(group)]++
+		buf[i] = a.ctrs[string(group)]
+	}
+	return buf,nil
+}
+func (a *fakeAllocator) RevertIds(group []byte,buf []uint64) error { return nil }
+
+func (g *global) numGroups() int {
+	g.RLock(); defer g.RUnlock()
+	return len(g.groups)
+}
+
+func alloc(r Requester, group string) (uint64,error) {
+	req := &Request{Group:[]byte(group)}
+	req.WG.Add(1)
+	if err := r.Offer(req); err!=nil { return 0,err }
+	req.WG.Wait()
+	return req.Number,req.Err
+}
+
+func TestIdleEviction(t *testing.T) {
+	for _,workers := range []int{0,4} {
+		a := &fakeAllocator{ctrs:make(map[string]uint64)}
+		g := NewRequesterOptions(a,Options{IdleTimeout:20*time.Millisecond,Workers:workers}).(*global)
+		for _,grp := range []string{"a","b","c"} {
+			if _,err := alloc(g,grp); err!=nil { t.Fatal(err) }
+		}
+		if n := g.numGroups(); n!=3 { t.Fatalf("workers=%d: %d groups, want 3",workers,n) }
+		
+		deadline := time.Now().Add(5*time.Second)
+		for g.numGroups()>0 {
+			if time.Now().After(deadline) { t.Fatalf("workers=%d: idle groups not evicted",workers) }
+			time.Sleep(5*time.Millisecond)
+		}
+		
+		// An evicted group is recreated and continues with its numbers.
+		if n,err := alloc(g,"a"); err!=nil || n!=2 { t.Fatalf("workers=%d: got %d %v, want 2",workers,n,err) }
+		if err := g.Close(); err!=nil { t.Fatal(err) }
+		if _,err := alloc(g,"a"); err!=ErrClosed { t.Fatalf("workers=%d: Offer after Close: %v",workers,err) }
+	}
+}
+
+// Offers race with eviction (a tiny IdleTimeout) and with Close. Every Offer
+// must either fail with ErrClosed or be served, and no number may be handed
+// out twice.
+func TestConcurrentOfferClose(t *testing.T) {
+	for _,workers := range []int{0,4} {
+		a := &fakeAllocator{ctrs:make(map[string]uint64)}
+		g := NewRequesterOptions(a,Options{IdleTimeout:time.Nanosecond,Workers:workers,RequestsPerGroup:4})
+		groups := []string{"a","b","c","d"}
+		
+		var mu sync.Mutex
+		seen := make(map[string]map[uint64]bool)
+		for _,grp := range groups { seen[grp] = make(map[uint64]bool) }
+		
+		var wg sync.WaitGroup
+		for i := 0; i<16; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; ; j++ {
+					grp := groups[(i+j)%len(groups)]
+					n,err := alloc(g,grp)
+					if err==ErrClosed { return }
+					if err!=nil { t.Error(err); return }
+					mu.Lock()
+					if seen[grp][n] { t.Errorf("group %s: number %d handed out twice",grp,n) }
+					seen[grp][n] = true
+					mu.Unlock()
+					if j%50==0 { time.Sleep(time.Millisecond) } // Let the janitor run.
+				}
+			}(i)
+		}
+		time.Sleep(100*time.Millisecond)
+		
+		done := make(chan error,1)
+		go func() { done <- g.Close() }()
+		select {
+		case err := <- done: if err!=nil { t.Fatal(err) }
+		case <- time.After(10*time.Second): t.Fatalf("workers=%d: Close did not return",workers)
+		}
+		wg.Wait()
+		
+		for _,grp := range groups {
+			if uint64(len(seen[grp]))!=a.ctrs[grp] { t.Errorf("workers=%d: group %s: %d numbers served, %d allocated",workers,grp,len(seen[grp]),a.ctrs[grp]) }
+		}
+	}
+}
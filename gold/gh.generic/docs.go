@@ -26,6 +26,11 @@ SOFTWARE.
 Helper to implement GroupHead sequences.
 
 Derived from Blue, with the Cassandra stuff scooped out.
+
+Requests are batched per group. By default, every active group has its own
+goroutine; with Options.Workers, a fixed pool of goroutines serves all groups.
+Idle groups are evicted after Options.IdleTimeout. Close() drains the queues
+and stops all goroutines.
 */
 package generic
 
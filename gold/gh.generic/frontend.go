@@ -24,7 +24,10 @@ SOFTWARE.
 
 package generic
 
+import "context"
+import "github.com/maxymania/fastnntp-polyglot/gold"
 import "sync"
+import "time"
 
 var pools = [...]sync.Pool{
 	sync.Pool{New:func()interface{}{ return make([]Request, 16) }},
@@ -60,52 +63,165 @@ type Requester interface {
 	Offer(p *Request) (err error)
 }
 
+/*
+Optional interface of a Requester.
+*/
+type ContextRequester interface {
+	// Like Offer, but gives up, if ctx is done before the Request could be queued.
+	OfferContext(ctx context.Context, p *Request) (err error)
+}
+
+func waitAll(ra []Request) {
+	for i := range ra { ra[i].WG.Wait() }
+}
+
 type Frontend struct {
 	R Requester
+	
+	// If >0, GroupHeadInsert and GroupHeadRevert give up after this time.
+	Timeout time.Duration
+}
+/*
+Returns true, if the Requester guarantees, that numbers are never reused
+(see Options.NeverReuse and MonotonicAllocator).
+*/
+func (f *Frontend) GroupHeadNeverReuse() bool {
+	nr,ok := f.R.(interface{ NeverReuse() bool })
+	return ok && nr.NeverReuse()
+}
+// Implement gold.Unwrapper. The Requester of NewRequester unwraps to its BulkAllocator.
+func (f *Frontend) Unwrap() interface{} { return f.R }
+
+func (f *Frontend) offer(ctx context.Context, r *Request) error {
+	if cr,ok := f.R.(ContextRequester); ok { return cr.OfferContext(ctx,r) }
+	return f.R.Offer(r)
+}
+
+// Waits for the Requests. If ctx is done first, 'abandon' is called after
+// the Requests completed, in the background.
+func (f *Frontend) await(ctx context.Context, sub []Request, abandon func()) bool {
+	if ctx.Done()==nil { waitAll(sub); return true }
+	ch := make(chan struct{})
+	go func() { waitAll(sub); close(ch) }()
+	select {
+	case <- ch: return true
+	case <- ctx.Done():
+		go func() { <- ch; abandon() }()
+		return false
+	}
+}
+
+// Reverts the successful allocations of an abandoned/failed GroupHeadInsert.
+func (f *Frontend) revertLate(ra, sub []Request) {
+	waitAll(sub)
+	var groups [][]byte
+	var nums []int64
+	for i := range sub {
+		if sub[i].Err!=nil { continue }
+		groups = append(groups,sub[i].Group)
+		nums = append(nums,int64(sub[i].Number))
+	}
+	freera(ra)
+	if len(groups)>0 { f.GroupHeadRevertContext(context.Background(),groups,nums) }
+}
+
+func (f *Frontend) withTimeout() (context.Context,context.CancelFunc) {
+	if f.Timeout>0 { return context.WithTimeout(context.Background(),f.Timeout) }
+	return context.Background(),func(){}
 }
+
 func (f *Frontend) GroupHeadInsert(groups [][]byte, buf []int64) (nums []int64, err error) {
+	ctx,cancel := f.withTimeout()
+	defer cancel()
+	return f.GroupHeadInsertContext(ctx,groups,buf)
+}
+func (f *Frontend) GroupHeadRevert(groups [][]byte, nums []int64) (err error) {
+	ctx,cancel := f.withTimeout()
+	defer cancel()
+	return f.GroupHeadRevertContext(ctx,groups,nums)
+}
+
+/*
+Like GroupHeadInsert, but gives up, if ctx is done. Numbers, that are allocated
+after giving up, are reverted in the background.
+*/
+func (f *Frontend) GroupHeadInsertContext(ctx context.Context, groups [][]byte, buf []int64) (nums []int64, err error) {
 	ra := allocra(len(groups)).([]Request)
+	sub := ra[:len(groups)]
 	for i := range groups {
-		r := &ra[i]
+		r := &sub[i]
 		r.IsRollback = false
 		r.Group = groups[i]
+		r.Number = 0
+		r.Err = nil
 		r.WG.Add(1)
-		err = f.R.Offer(r)
-		if err!=nil { return }
+		err = f.offer(ctx,r)
+		if err!=nil {
+			r.WG.Done()
+			go f.revertLate(ra,sub[:i])
+			return
+		}
+	}
+	if !f.await(ctx,sub,func(){ f.revertLate(ra,sub) }) { return nil,ctx.Err() }
+	for i := range sub {
+		if sub[i].Err!=nil {
+			err = sub[i].Err
+			go f.revertLate(ra,sub)
+			return
+		}
 	}
 	if cap(buf)<len(groups) {
 		nums = make([]int64,len(groups))
 	} else {
 		nums = buf[:len(groups)]
 	}
-	for i := range groups {
-		r := &ra[i]
-		r.WG.Wait()
-		err = r.Err
-		nums[i] = int64(r.Number)
-		if err!=nil { return }
-	}
+	for i := range sub { nums[i] = int64(sub[i].Number) }
 	freera(ra)
 	return
 }
-func (f *Frontend) GroupHeadRevert(groups [][]byte, nums []int64) (err error) {
+
+/*
+Like GroupHeadRevert, but gives up waiting, if ctx is done.
+*/
+func (f *Frontend) GroupHeadRevertContext(ctx context.Context, groups [][]byte, nums []int64) (err error) {
 	ra := allocra(len(groups)).([]Request)
+	sub := ra[:len(groups)]
 	for i := range groups {
-		r := &ra[i]
+		r := &sub[i]
 		r.IsRollback = true
 		r.Group = groups[i]
 		r.Number = uint64(nums[i])
+		r.Err = nil
 		r.WG.Add(1)
-		err = f.R.Offer(r)
-		if err!=nil { return }
+		err = f.offer(ctx,r)
+		if err!=nil {
+			r.WG.Done()
+			sub = sub[:i]
+			go func() { waitAll(sub); freera(ra) }()
+			return
+		}
 	}
-	for i := range groups {
-		r := &ra[i]
-		r.WG.Wait()
-		err = r.Err
-		if err!=nil { return }
+	if !f.await(ctx,sub,func(){ freera(ra) }) { return ctx.Err() }
+	for i := range sub {
+		if sub[i].Err!=nil { err = sub[i].Err; break }
 	}
 	freera(ra)
 	return
 }
 
+/*
+Implements newspolyglot.GroupHeadAdvancer, if the Requester (and its
+BulkAllocator) implements AdvancingAllocator. Otherwise ErrNotSupported is
+returned.
+*/
+func (f *Frontend) GroupHeadAdvance(groups [][]byte, nums []int64) error {
+	aa,ok := f.R.(AdvancingAllocator)
+	if !ok { return ErrNotSupported }
+	for i,group := range groups {
+		if nums[i]<1 { continue }
+		if err := aa.AdvanceIds(group,uint64(nums[i])); err!=nil { return err }
+	}
+	return nil
+}
+
+var _ gold.Unwrapper = (*Frontend)(nil)
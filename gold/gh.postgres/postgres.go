@@ -31,7 +31,15 @@ import "github.com/maxymania/fastnntp-polyglot/gold/gh.generic"
 
 type PsqlBulkAllocator struct {
 	DB *sql.DB
+	
+	// If true, released numbers are not put onto the free list (ghlst), and
+	// numbers are always taken from the counter (ghctr).
+	NeverReuse bool
 }
+
+// Implements generic.MonotonicAllocator.
+func (p *PsqlBulkAllocator) AllocatorNeverReuse() bool { return p.NeverReuse }
+
 func (p *PsqlBulkAllocator) Init() {
 	p.DB.Exec(`
 		CREATE TABLE groupheads (
@@ -52,9 +60,9 @@ func (p *PsqlBulkAllocator) AllocIds(group []byte, buf []uint64) ([]uint64, erro
 		err = p.DB.QueryRow(`
 			update groupheads set ghctr = ghctr+$2
 				where ghnam = $1
-				and coalesce(array_length(ghlst,1),0)=0
+				and ($3 or coalesce(array_length(ghlst,1),0)=0)
 			returning ghctr;
-		`,group,len(buf)).Scan(&nctr)
+		`,group,len(buf),p.NeverReuse).Scan(&nctr)
 		if err==nil {
 			n := len(buf)-1
 			for i := range buf {
@@ -65,6 +73,7 @@ func (p *PsqlBulkAllocator) AllocIds(group []byte, buf []uint64) ([]uint64, erro
 		}
 		if err!=sql.ErrNoRows { return nil,err }
 	}
+	if p.NeverReuse { goto noRows }
 	
 	{
 		var array pq.Int64Array
@@ -91,6 +100,7 @@ func (p *PsqlBulkAllocator) AllocIds(group []byte, buf []uint64) ([]uint64, erro
 	return buf,nil
 }
 func (p *PsqlBulkAllocator) RevertIds(group []byte, buf []uint64) error {
+	if p.NeverReuse { return nil }
 	array := make(pq.Int64Array,len(buf))
 	for i,num := range buf { array[i] = int64(num) }
 	//_,err := p.DB.Exec(`update groupheads set ghlst = ghlst || ($2)::bigint[] where ghnam = $1`,group,array)
@@ -102,6 +112,24 @@ func (p *PsqlBulkAllocator) RevertIds(group []byte, buf []uint64) error {
 	return err
 }
 
+func (p *PsqlBulkAllocator) AdvanceIds(group []byte, num uint64) error {
+	res,err := p.DB.Exec(`
+		update groupheads set
+			ghctr = greatest(ghctr,$2),
+			ghlst = array(select x from unnest(ghlst) x where x>$2 order by 1)
+		where ghnam = $1
+	`,group,int64(num))
+	if err!=nil { return err }
+	if n,_ := res.RowsAffected(); n>0 { return nil }
+	_,err = p.DB.Exec(`
+		insert into groupheads (ghnam,ghctr) values ($1,$2)
+			on conflict (ghnam) do update set ghctr = greatest(groupheads.ghctr,$2)
+	`,group,int64(num))
+	return err
+}
+
 var _ generic.BulkAllocator = (*PsqlBulkAllocator)(nil)
+var _ generic.AdvancingAllocator = (*PsqlBulkAllocator)(nil)
+var _ generic.MonotonicAllocator = (*PsqlBulkAllocator)(nil)
 
 // #
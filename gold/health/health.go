@@ -0,0 +1,163 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+Health checks for backends.
+*/
+package health
+
+import (
+	"github.com/maxymania/fastnntp-polyglot/caps"
+	"github.com/maxymania/fastnntp-polyglot/gold"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+/*
+Implemented by backends (and clients of remote backends), that can check,
+whether they are alive.
+*/
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+/*
+Returns the backend objects of a Caps (and the objects in 'extra'), looking
+into decorators (gold.Unwrapper) and composites (gold.Composite). Every object
+is returned once.
+*/
+func Components(c *caps.Caps, extra ...interface{}) (all []interface{}) {
+	var add func(i interface{})
+	add = func(i interface{}) {
+		if i==nil { return }
+		if t := reflect.TypeOf(i); !t.Comparable() { return }
+		for _,j := range all { if j==i { return } }
+		all = append(all,i)
+		if u,ok := i.(gold.Unwrapper); ok { add(u.Unwrap()) }
+		if c,ok := i.(gold.Composite); ok {
+			for _,j := range c.Parts() { add(j) }
+		}
+	}
+	if c!=nil {
+		add(c.GroupHeadDB)
+		add(c.GroupHeadCache)
+		add(c.ArticlePostingDB)
+		add(c.ArticleDirectDB)
+		add(c.ArticleGroupDB)
+		add(c.GroupRealtimeDB)
+		add(c.GroupStaticDB)
+	}
+	for _,i := range extra { add(i) }
+	return
+}
+
+type Status struct {
+	Name    string        `json:"name"`
+	OK      bool          `json:"ok"`
+	Error   string        `json:"error,omitempty"`
+	Latency time.Duration `json:"latency_ns"`
+}
+
+type Report struct {
+	OK         bool     `json:"ok"`
+	Components []Status `json:"components"`
+}
+
+/*
+Checks all backends of a Caps, that implement Pinger.
+*/
+type Checker struct {
+	Caps  *caps.Caps
+	Extra []interface{}
+	
+	// Maximum time per Ping. Defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+func (c *Checker) timeout() time.Duration {
+	if c.Timeout<=0 { return 5*time.Second }
+	return c.Timeout
+}
+
+func (c *Checker) ping(ctx context.Context, p Pinger, st *Status) {
+	ctx,cancel := context.WithTimeout(ctx,c.timeout())
+	defer cancel()
+	
+	// Some Pingers can't be interrupted. Don't wait for them.
+	ch := make(chan error,1)
+	begin := time.Now()
+	go func() { ch <- p.Ping(ctx) }()
+	var err error
+	select {
+	case err = <- ch:
+	case <- ctx.Done(): err = ctx.Err()
+	}
+	st.Latency = time.Since(begin)
+	st.OK = err==nil
+	if err!=nil { st.Error = err.Error() }
+}
+
+func (c *Checker) Check(ctx context.Context) *Report {
+	rep := &Report{OK:true}
+	names := make(map[string]int)
+	var pingers []Pinger
+	for _,i := range Components(c.Caps,c.Extra...) {
+		p,ok := i.(Pinger)
+		if !ok { continue }
+		name := fmt.Sprintf("%T",i)
+		names[name]++
+		if n := names[name]; n>1 { name = fmt.Sprintf("%s#%d",name,n) }
+		pingers = append(pingers,p)
+		rep.Components = append(rep.Components,Status{Name:name})
+	}
+	
+	var wg sync.WaitGroup
+	for i,p := range pingers {
+		wg.Add(1)
+		go func(p Pinger, st *Status) {
+			defer wg.Done()
+			c.ping(ctx,p,st)
+		}(p,&rep.Components[i])
+	}
+	wg.Wait()
+	for _,st := range rep.Components {
+		if !st.OK { rep.OK = false }
+	}
+	return rep
+}
+
+/*
+Serves the Report as JSON. The status code is 503, if any backend is not ok.
+*/
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rep := c.Check(r.Context())
+	w.Header().Set("Content-Type","application/json")
+	if !rep.OK { w.WriteHeader(http.StatusServiceUnavailable) }
+	json.NewEncoder(w).Encode(rep)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package gold
+
+import "time"
+
+/*
+The History remembers the Message-IDs of articles, even after they have been
+expired, so that peers can't re-feed them.
+*/
+type HistoryDB interface {
+	// Records the Message-ID of an article expiring at 'exp' (Unix time).
+	HistoryRemember(id []byte, exp uint64) (err error)
+	
+	// Returns true, if the Message-ID is (still) remembered.
+	HistoryLookup(id []byte) bool
+}
+
+/*
+Optional interface implemented by HistoryDB implementations, that need
+periodic pruning of forgotten Message-IDs.
+*/
+type HistoryPruner interface {
+	HistoryPrune(now uint64) (err error)
+}
+
+/*
+Calls h.HistoryPrune() every 'interval' until 'stop' is closed.
+*/
+func HistoryPruneLoop(h HistoryPruner, interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <- stop: return
+		case now := <- t.C:
+			h.HistoryPrune(uint64(now.Unix()))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+Badger backend for gold.HistoryDB. Uses Badger's expiration feature, so
+forgotten Message-IDs vanish automatically.
+*/
+package hsbadger
+
+import "github.com/dgraph-io/badger"
+import "github.com/maxymania/fastnntp-polyglot/gold"
+import "github.com/maxymania/fastnntp-polyglot/gold/maint"
+import "time"
+
+// 24 Hours in seconds
+const DAY = 60*60*24
+
+// Key prefix, seperating the history from other data in the same database.
+var prefix = []byte("hist\x00")
+
+func key(id []byte) []byte {
+	k := make([]byte,0,len(prefix)+len(id))
+	return append(append(k,prefix...),id...)
+}
+
+type History struct {
+	DB *badger.DB
+	
+	// Seconds to remember an article after it expired, defaults to 30 days.
+	Remember uint64
+	
+	// Discard ratio for the value log garbage collection, defaults to 0.5
+	DiscardRatio float64
+}
+
+func (h *History) HistoryRemember(id []byte, exp uint64) error {
+	until := exp+h.Remember
+	if h.Remember==0 { until = exp+(30*DAY) }
+	return h.DB.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(&badger.Entry{
+			Key: key(id),
+			ExpiresAt: until,
+		})
+	})
+}
+
+func (h *History) HistoryLookup(id []byte) bool {
+	return h.DB.View(func(txn *badger.Txn) error {
+		_,err := txn.Get(key(id))
+		return err
+	})==nil
+}
+
+/*
+Expired entries are dropped by Badger itself, this only reclaims the space in
+the value log.
+*/
+func (h *History) HistoryPrune(now uint64) (err error) {
+	dr := h.DiscardRatio
+	if dr<=0 || dr>=1 { dr = 0.5 }
+	for err==nil { err = h.DB.RunValueLogGC(dr) }
+	if err==badger.ErrNoRewrite { err = nil }
+	return
+}
+
+// Returns a task, that prunes the history every hour.
+func (h *History) MaintainanceTasks() []*maint.Task {
+	return []*maint.Task{maint.HistoryTask(h,time.Hour)}
+}
+
+var _ gold.HistoryDB = (*History)(nil)
+var _ gold.HistoryPruner = (*History)(nil)
+var _ maint.Provider = (*History)(nil)
@@ -0,0 +1,130 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+BoltDB backend for gold.HistoryDB.
+*/
+package hsbolt
+
+import "github.com/boltdb/bolt"
+import "github.com/maxymania/fastnntp-polyglot/gold"
+import "github.com/maxymania/fastnntp-polyglot/gold/maint"
+import "encoding/binary"
+import "time"
+
+// 24 Hours in seconds
+const DAY = 60*60*24
+
+// "Tables" AKA Buckets
+var tHSMSGID = []byte("hsmsgid") // Message-ID -> Forget-At
+var tHSUNTIL = []byte("hsuntil") // Forget-At + Message-ID -> ""
+
+type History struct {
+	DB *bolt.DB
+	
+	// Seconds to remember an article after it expired, defaults to 30 days.
+	Remember uint64
+}
+
+func (h *History) Initialize() {
+	h.DB.Update(func(tx *bolt.Tx) error {
+		tx.CreateBucketIfNotExists(tHSMSGID)
+		tx.CreateBucketIfNotExists(tHSUNTIL)
+		return nil
+	})
+}
+
+func (h *History) forgetAt(exp uint64) uint64 {
+	if h.Remember==0 { return exp+(30*DAY) }
+	return exp+h.Remember
+}
+
+func untilKey(until uint64, id []byte) []byte {
+	k := make([]byte,8,8+len(id))
+	binary.BigEndian.PutUint64(k,until)
+	return append(k,id...)
+}
+
+func (h *History) HistoryRemember(id []byte, exp uint64) error {
+	until := h.forgetAt(exp)
+	return h.DB.Update(func(tx *bolt.Tx) error {
+		msgs := tx.Bucket(tHSMSGID)
+		idx  := tx.Bucket(tHSUNTIL)
+		if v := msgs.Get(id); len(v)==8 {
+			old := binary.BigEndian.Uint64(v)
+			if old>=until { return nil } // Already remembered long enough.
+			if err := idx.Delete(untilKey(old,id)); err!=nil { return err }
+		}
+		var v [8]byte
+		binary.BigEndian.PutUint64(v[:],until)
+		if err := msgs.Put(id,v[:]); err!=nil { return err }
+		return idx.Put(untilKey(until,id),nil)
+	})
+}
+
+func (h *History) HistoryLookup(id []byte) (ok bool) {
+	now := uint64(time.Now().Unix())
+	h.DB.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(tHSMSGID).Get(id)
+		ok = len(v)==8 && binary.BigEndian.Uint64(v)>now
+		return nil
+	})
+	return
+}
+
+/*
+Removes all Message-IDs that have been remembered long enough.
+The work is split up into multiple transactions, to keep them short.
+*/
+func (h *History) HistoryPrune(now uint64) error {
+	keys := make([][]byte,0,1024)
+	for {
+		keys = keys[:0]
+		err := h.DB.Update(func(tx *bolt.Tx) error {
+			msgs := tx.Bucket(tHSMSGID)
+			idx  := tx.Bucket(tHSUNTIL)
+			c := idx.Cursor()
+			for k,_ := c.First(); len(k)>=8 && len(keys)<cap(keys) ; k,_ = c.Next() {
+				if binary.BigEndian.Uint64(k)>now { break }
+				keys = append(keys,append([]byte(nil),k...))
+			}
+			for _,k := range keys {
+				if err := idx.Delete(k); err!=nil { return err }
+				if err := msgs.Delete(k[8:]); err!=nil { return err }
+			}
+			return nil
+		})
+		if err!=nil { return err }
+		if len(keys)<cap(keys) { return nil }
+	}
+}
+
+// Returns a task, that prunes the history every hour.
+func (h *History) MaintainanceTasks() []*maint.Task {
+	return []*maint.Task{maint.HistoryTask(h,time.Hour)}
+}
+
+var _ gold.HistoryDB = (*History)(nil)
+var _ gold.HistoryPruner = (*History)(nil)
+var _ maint.Provider = (*History)(nil)
@@ -0,0 +1,328 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+Write-ahead intent journal for postings.
+
+A posting spans multiple backends (group heads, article store, group index),
+that can't be updated atomically. The journal records every step in a local
+file, so that postings, that were interrupted by a crash, can be completed or
+rolled back at startup.
+
+Every posting gets a unique token, that identifies its records in the file.
+While a posting is in progress, its Message-ID refers to it; a second posting
+of the same Message-ID can't begin, before the first one has ended.
+
+All methods of a nil *Journal are no-ops.
+*/
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+type Step byte
+const (
+	// The article has been stored (ArticleDirectStore).
+	StepStored Step = 1<<iota
+	
+	// The article has been added to the group index (StoreArticleInfos).
+	// From here on, the posting is complete.
+	StepIndexed
+	
+	// StoreArticleInfos has been started, so the group index might contain
+	// entries with the article numbers of the posting.
+	StepIndexing
+)
+
+const (
+	rBegin = 'B'
+	rMark  = 'M'
+	rEnd   = 'E'
+)
+
+var ErrCorrupt = errors.New("journal: corrupt record")
+var ErrBusy = errors.New("journal: posting with this Message-ID in progress")
+
+/*
+An interrupted posting.
+*/
+type Intent struct {
+	Token  uint64
+	MsgId  []byte
+	Groups [][]byte
+	Nums   []int64
+	Steps  Step
+}
+
+type Journal struct {
+	// If true, records are not synced to disk.
+	NoSync bool
+	
+	// If >0, the journal is compacted, once it grows beyond MaxSize bytes.
+	// Defaults to 64 MiB.
+	MaxSize int64
+	
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	size int64
+	seq  uint64
+	open map[uint64]*Intent  // By token.
+	act  map[string]*Intent  // Postings in progress, by Message-ID.
+	pend []*Intent
+}
+
+func (j *Journal) maxSize() int64 {
+	if j.MaxSize<=0 { return 64<<20 }
+	return j.MaxSize
+}
+
+/*
+Opens (or creates) the journal at 'path'. The postings, that have not been
+finished, are returned by Pending() and should be passed to Recover.
+*/
+func Open(path string) (*Journal,error) {
+	j := &Journal{path:path,open:make(map[uint64]*Intent),act:make(map[string]*Intent)}
+	f,err := os.Open(path)
+	if err==nil {
+		err = j.replay(bufio.NewReader(f))
+		f.Close()
+		if err!=nil && err!=ErrCorrupt { return nil,err }
+	} else if !os.IsNotExist(err) {
+		return nil,err
+	}
+	for _,in := range j.open {
+		j.pend = append(j.pend,in)
+		if j.seq<in.Token { j.seq = in.Token }
+	}
+	
+	// Rewrite the journal, dropping finished postings and torn records.
+	if err = j.compact(); err!=nil { return nil,err }
+	return j,nil
+}
+
+/*
+Returns the postings, that have not been finished, when the journal was
+opened.
+*/
+func (j *Journal) Pending() []*Intent {
+	if j==nil { return nil }
+	j.mu.Lock(); defer j.mu.Unlock()
+	return j.pend
+}
+
+// Reads records until EOF or a torn/corrupt record.
+func (j *Journal) replay(r *bufio.Reader) error {
+	var hdr [8]byte
+	for {
+		if _,err := io.ReadFull(r,hdr[:]); err!=nil {
+			if err==io.EOF { return nil }
+			return ErrCorrupt
+		}
+		n := binary.BigEndian.Uint32(hdr[:])
+		if n>(16<<20) { return ErrCorrupt }
+		rec := make([]byte,n)
+		if _,err := io.ReadFull(r,rec); err!=nil { return ErrCorrupt }
+		if crc32.ChecksumIEEE(rec)!=binary.BigEndian.Uint32(hdr[4:]) { return ErrCorrupt }
+		if err := j.apply(rec); err!=nil { return err }
+	}
+}
+
+func readField(rec []byte) (f,rest []byte, err error) {
+	n,k := binary.Uvarint(rec)
+	if k<=0 || uint64(len(rec)-k)<n { return nil,nil,ErrCorrupt }
+	return rec[k:k+int(n)],rec[k+int(n):],nil
+}
+
+func (j *Journal) apply(rec []byte) error {
+	if len(rec)<9 { return ErrCorrupt }
+	typ := rec[0]
+	tok := binary.BigEndian.Uint64(rec[1:])
+	rest := rec[9:]
+	var err error
+	switch typ {
+	case rBegin:
+		in := &Intent{Token:tok}
+		if in.MsgId,rest,err = readField(rest); err!=nil { return err }
+		for len(rest)>0 {
+			var g []byte
+			if g,rest,err = readField(rest); err!=nil { return err }
+			v,k := binary.Varint(rest)
+			if k<=0 { return ErrCorrupt }
+			rest = rest[k:]
+			in.Groups = append(in.Groups,g)
+			in.Nums = append(in.Nums,v)
+		}
+		j.open[tok] = in
+	case rMark:
+		if len(rest)!=1 { return ErrCorrupt }
+		if in := j.open[tok]; in!=nil { in.Steps |= Step(rest[0]) }
+	case rEnd:
+		delete(j.open,tok)
+	default:
+		return ErrCorrupt
+	}
+	return nil
+}
+
+func appendField(b, f []byte) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	b = append(b,buf[:binary.PutUvarint(buf[:],uint64(len(f)))]...)
+	return append(b,f...)
+}
+func appendNum(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b,buf[:binary.PutVarint(buf[:],v)]...)
+}
+func appendToken(b []byte, typ byte, tok uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:],tok)
+	return append(append(b,typ),buf[:]...)
+}
+func encodeBegin(b []byte, in *Intent) []byte {
+	b = appendField(appendToken(b,rBegin,in.Token),in.MsgId)
+	for i,g := range in.Groups {
+		b = appendNum(appendField(b,g),in.Nums[i])
+	}
+	return b
+}
+func encodeMark(b []byte, tok uint64, s Step) []byte {
+	return append(appendToken(b,rMark,tok),byte(s))
+}
+func frame(w *bytes.Buffer, rec []byte) {
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[:],uint32(len(rec)))
+	binary.BigEndian.PutUint32(hdr[4:],crc32.ChecksumIEEE(rec))
+	w.Write(hdr[:])
+	w.Write(rec)
+}
+
+// Rewrites the journal with the open postings only. Must hold j.mu or be
+// called from Open().
+func (j *Journal) compact() error {
+	var w bytes.Buffer
+	for _,in := range j.open {
+		frame(&w,encodeBegin(nil,in))
+		if in.Steps!=0 { frame(&w,encodeMark(nil,in.Token,in.Steps)) }
+	}
+	tmp := j.path+".tmp"
+	f,err := os.OpenFile(tmp,os.O_CREATE|os.O_TRUNC|os.O_WRONLY,0600)
+	if err!=nil { return err }
+	if _,err = f.Write(w.Bytes()); err==nil { err = f.Sync() }
+	if err==nil { err = os.Rename(tmp,j.path) }
+	if err!=nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if j.f!=nil { j.f.Close() }
+	j.f = f
+	j.size = int64(w.Len())
+	return nil
+}
+
+func (j *Journal) write(rec []byte) error {
+	var w bytes.Buffer
+	frame(&w,rec)
+	if _,err := j.f.Write(w.Bytes()); err!=nil { return err }
+	j.size += int64(w.Len())
+	if !j.NoSync {
+		if err := j.f.Sync(); err!=nil { return err }
+	}
+	if j.size>j.maxSize() { return j.compact() }
+	return nil
+}
+
+/*
+Records the begin of a posting, after its article numbers have been allocated.
+Returns ErrBusy, if a posting with the same Message-ID is in progress.
+*/
+func (j *Journal) Begin(id []byte, groups [][]byte, nums []int64) error {
+	if j==nil { return nil }
+	in := &Intent{MsgId:append([]byte(nil),id...),Nums:append([]int64(nil),nums...)}
+	for _,g := range groups { in.Groups = append(in.Groups,append([]byte(nil),g...)) }
+	
+	j.mu.Lock(); defer j.mu.Unlock()
+	if j.f==nil { return os.ErrClosed }
+	if j.act[string(in.MsgId)]!=nil { return ErrBusy }
+	j.seq++
+	in.Token = j.seq
+	if err := j.write(encodeBegin(nil,in)); err!=nil { return err }
+	j.open[in.Token] = in
+	j.act[string(in.MsgId)] = in
+	return nil
+}
+
+/*
+Records, that a step of the posting in progress with this Message-ID has been
+performed.
+*/
+func (j *Journal) Mark(id []byte, s Step) error {
+	if j==nil { return nil }
+	j.mu.Lock(); defer j.mu.Unlock()
+	if j.f==nil { return os.ErrClosed }
+	in := j.act[string(id)]
+	if in==nil { return nil }
+	if err := j.write(encodeMark(nil,in.Token,s)); err!=nil { return err }
+	in.Steps |= s
+	return nil
+}
+
+/*
+Records, that the posting in progress with this Message-ID has been finished,
+either completed or rolled back.
+*/
+func (j *Journal) End(id []byte) error {
+	if j==nil { return nil }
+	j.mu.Lock(); defer j.mu.Unlock()
+	if j.f==nil { return os.ErrClosed }
+	in := j.act[string(id)]
+	if in==nil { return nil }
+	delete(j.act,string(id))
+	return j.end(in)
+}
+
+// Must hold j.mu.
+func (j *Journal) end(in *Intent) error {
+	if j.open[in.Token]==nil { return nil }
+	delete(j.open,in.Token)
+	return j.write(appendToken(nil,rEnd,in.Token))
+}
+
+func (j *Journal) Close() error {
+	if j==nil { return nil }
+	j.mu.Lock(); defer j.mu.Unlock()
+	if j.f==nil { return os.ErrClosed }
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
@@ -0,0 +1,133 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package journal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type fakeHeads struct {
+	reverted map[string]int64
+}
+func (h *fakeHeads) GroupHeadInsert(groups [][]byte, buf []int64) ([]int64,error) { return buf,nil }
+func (h *fakeHeads) GroupHeadRevert(groups [][]byte, nums []int64) error {
+	for i,g := range groups { h.reverted[string(g)] = nums[i] }
+	return nil
+}
+
+type fakeDir struct {
+	rolledBack map[string]bool
+}
+func (d *fakeDir) ArticleDirectRollback(id []byte) { d.rolledBack[string(id)] = true }
+
+func tempJournal(t *testing.T) string {
+	dir,err := ioutil.TempDir("","journal")
+	if err!=nil { t.Fatal(err) }
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir,"journal")
+}
+
+// Simulates a crash (Close without End) in every step and recovers.
+func TestCrashRecover(t *testing.T) {
+	path := tempJournal(t)
+	j,err := Open(path)
+	if err!=nil { t.Fatal(err) }
+	
+	begin := func(id, group string, num int64) {
+		if err := j.Begin([]byte(id),[][]byte{[]byte(group)},[]int64{num}); err!=nil { t.Fatal(err) }
+	}
+	mark := func(id string, s Step) {
+		if err := j.Mark([]byte(id),s); err!=nil { t.Fatal(err) }
+	}
+	
+	begin("<begun@x>","a",1)
+	
+	begin("<stored@x>","b",2)
+	mark("<stored@x>",StepStored)
+	
+	begin("<indexing@x>","c",3)
+	mark("<indexing@x>",StepStored|StepIndexing)
+	
+	begin("<indexed@x>","d",4)
+	mark("<indexed@x>",StepStored|StepIndexing)
+	mark("<indexed@x>",StepIndexed)
+	
+	begin("<done@x>","e",5)
+	mark("<done@x>",StepStored|StepIndexing)
+	mark("<done@x>",StepIndexed)
+	if err := j.End([]byte("<done@x>")); err!=nil { t.Fatal(err) }
+	
+	if err := j.Begin([]byte("<begun@x>"),nil,nil); err!=ErrBusy { t.Fatalf("Begin of an active posting: %v",err) }
+	j.Close()
+	
+	// A torn record at the end must be ignored.
+	f,err := os.OpenFile(path,os.O_APPEND|os.O_WRONLY,0)
+	if err!=nil { t.Fatal(err) }
+	f.Write([]byte{0,0,0,40,1,2,3})
+	f.Close()
+	
+	j,err = Open(path)
+	if err!=nil { t.Fatal(err) }
+	pend := make(map[string]Step)
+	for _,in := range j.Pending() { pend[string(in.MsgId)] = in.Steps }
+	want := map[string]Step{
+		"<begun@x>": 0,
+		"<stored@x>": StepStored,
+		"<indexing@x>": StepStored|StepIndexing,
+		"<indexed@x>": StepStored|StepIndexing|StepIndexed,
+	}
+	if len(pend)!=len(want) { t.Fatalf("pending %v, want %v",pend,want) }
+	for id,s := range want {
+		if st,ok := pend[id]; !ok || st!=s { t.Errorf("%s: steps %v (pending %v), want %v",id,st,ok,s) }
+	}
+	
+	heads := &fakeHeads{make(map[string]int64)}
+	dir := &fakeDir{make(map[string]bool)}
+	if err := j.Recover(heads,dir); err!=nil { t.Fatal(err) }
+	
+	// Rolled back: article removed, numbers released.
+	for _,c := range []struct{ id, group string; num int64 }{{"<begun@x>","a",1},{"<stored@x>","b",2}} {
+		if !dir.rolledBack[c.id] { t.Errorf("%s: not rolled back",c.id) }
+		if heads.reverted[c.group]!=c.num { t.Errorf("%s: number not released",c.id) }
+	}
+	// Completed: article and numbers kept.
+	for _,c := range []struct{ id, group string }{{"<indexing@x>","c"},{"<indexed@x>","d"}} {
+		if dir.rolledBack[c.id] { t.Errorf("%s: rolled back",c.id) }
+		if _,ok := heads.reverted[c.group]; ok { t.Errorf("%s: number released",c.id) }
+	}
+	if n := len(j.Pending()); n!=0 { t.Errorf("%d postings pending after Recover",n) }
+	j.Close()
+	
+	j,err = Open(path)
+	if err!=nil { t.Fatal(err) }
+	defer j.Close()
+	if n := len(j.Pending()); n!=0 { t.Errorf("%d postings pending after reopening",n) }
+	
+	// The Message-IDs are free again.
+	if err := j.Begin([]byte("<begun@x>"),nil,nil); err!=nil { t.Fatal(err) }
+}
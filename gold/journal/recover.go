@@ -0,0 +1,77 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package journal
+
+import "github.com/maxymania/fastnntp-polyglot"
+import "os"
+
+type ArticleRollback interface {
+	ArticleDirectRollback(id []byte)
+}
+
+/*
+Finishes the postings, that have been interrupted (see Pending()).
+
+Postings, that have reached StepIndexed, are complete. Postings, that have
+been interrupted during StoreArticleInfos (StepIndexing), are completed as
+well: the article has been stored, and the group index might contain entries
+pointing to it, so the article is kept and so are the article numbers (the
+groups, that have not been indexed, have a gap). All others are rolled back:
+the article is removed from the article store (if it has been stored) and
+the article numbers are released.
+*/
+func (j *Journal) Recover(heads newspolyglot.GroupHeadDB, dir ArticleRollback) (err error) {
+	if j==nil { return nil }
+	j.mu.Lock()
+	pend := j.pend
+	j.mu.Unlock()
+	
+	var rest []*Intent
+	for _,in := range pend {
+		if in.Steps&(StepIndexed|StepIndexing)==0 {
+			// The store might have happened without being marked, so roll back anyway.
+			if dir!=nil { dir.ArticleDirectRollback(in.MsgId) }
+			if len(in.Groups)>0 && heads!=nil {
+				if e := heads.GroupHeadRevert(in.Groups,in.Nums); e!=nil {
+					err = e
+					rest = append(rest,in)
+					continue
+				}
+			}
+		}
+		j.mu.Lock()
+		if j.f==nil {
+			err = os.ErrClosed
+		} else if e := j.end(in); e!=nil {
+			err = e
+		}
+		j.mu.Unlock()
+	}
+	
+	j.mu.Lock()
+	j.pend = rest
+	j.mu.Unlock()
+	return
+}
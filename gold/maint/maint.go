@@ -0,0 +1,220 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+Maintainance scheduler.
+
+Backends, that need periodic housekeeping (expiring rows, garbage collection,
+pruning), offer it as Tasks; the Scheduler runs them in the background.
+*/
+package maint
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/*
+A periodic maintainance task.
+*/
+type Task struct {
+	Name     string
+	
+	// Time between two runs.
+	Interval time.Duration
+	
+	// A random delay of up to Jitter is added to every Interval.
+	Jitter   time.Duration
+	
+	Run      func(ctx context.Context) error
+}
+
+/*
+Implemented by backends, that offer maintainance tasks.
+*/
+type Provider interface {
+	MaintainanceTasks() []*Task
+}
+
+/*
+Status of a registered task.
+*/
+type Status struct {
+	Name     string
+	Running  bool
+	LastRun  time.Time
+	LastTook time.Duration
+	LastErr  error
+	Runs     int64
+	Failures int64
+}
+
+type entry struct {
+	task    *Task
+	running bool
+	status  Status
+}
+
+/*
+The Scheduler runs the registered tasks periodically. Each task has at most
+one run in flight at any time.
+*/
+type Scheduler struct {
+	// Called, if a task returns an error. Defaults to log.Printf.
+	OnError func(name string, err error)
+	
+	mu      sync.Mutex
+	entries []*entry
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func (s *Scheduler) onError(name string, err error) {
+	if s.OnError!=nil {
+		s.OnError(name,err)
+	} else {
+		log.Printf("maint: task %q failed: %v",name,err)
+	}
+}
+
+/*
+Registers tasks. Tasks registered after Start() are started immediately.
+*/
+func (s *Scheduler) Register(tasks ...*Task) {
+	s.mu.Lock(); defer s.mu.Unlock()
+	for _,t := range tasks {
+		if t==nil || t.Run==nil || t.Interval<=0 { continue }
+		e := &entry{task:t}
+		e.status.Name = t.Name
+		s.entries = append(s.entries,e)
+		if s.ctx!=nil { s.spawn(e) }
+	}
+}
+
+/*
+Registers the tasks of a Provider.
+*/
+func (s *Scheduler) RegisterProvider(p Provider) {
+	s.Register(p.MaintainanceTasks()...)
+}
+
+func (s *Scheduler) spawn(e *entry) {
+	s.wg.Add(1)
+	go s.loop(s.ctx,e)
+}
+
+/*
+Starts the scheduler. Calling Start() on a running scheduler is a no-op.
+*/
+func (s *Scheduler) Start() {
+	s.mu.Lock(); defer s.mu.Unlock()
+	if s.ctx!=nil { return }
+	s.ctx,s.cancel = context.WithCancel(context.Background())
+	for _,e := range s.entries { s.spawn(e) }
+}
+
+/*
+Stops the scheduler. Running tasks see their context cancelled; Stop() waits
+until they returned.
+*/
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.ctx,s.cancel = nil,nil
+	s.mu.Unlock()
+	if cancel==nil { return }
+	cancel()
+	s.wg.Wait()
+}
+
+/*
+Runs the task named 'name' now, unless it is already running.
+Returns false, if there is no such task or it is already running.
+*/
+func (s *Scheduler) RunNow(ctx context.Context, name string) bool {
+	s.mu.Lock()
+	var e *entry
+	for _,f := range s.entries {
+		if f.task.Name==name { e = f; break }
+	}
+	s.mu.Unlock()
+	if e==nil { return false }
+	return s.run(ctx,e)
+}
+
+/*
+Returns the status of all registered tasks.
+*/
+func (s *Scheduler) Status() []Status {
+	s.mu.Lock(); defer s.mu.Unlock()
+	st := make([]Status,len(s.entries))
+	for i,e := range s.entries {
+		st[i] = e.status
+		st[i].Running = e.running
+	}
+	return st
+}
+
+func (s *Scheduler) run(ctx context.Context, e *entry) bool {
+	s.mu.Lock()
+	if e.running { s.mu.Unlock(); return false }
+	e.running = true
+	s.mu.Unlock()
+	
+	begin := time.Now()
+	err := e.task.Run(ctx)
+	took := time.Since(begin)
+	
+	s.mu.Lock()
+	e.running = false
+	e.status.LastRun = begin
+	e.status.LastTook = took
+	e.status.LastErr = err
+	e.status.Runs++
+	if err!=nil { e.status.Failures++ }
+	s.mu.Unlock()
+	
+	if err!=nil && ctx.Err()==nil { s.onError(e.task.Name,err) }
+	return true
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	defer s.wg.Done()
+	for {
+		d := e.task.Interval
+		if e.task.Jitter>0 { d += time.Duration(rand.Int63n(int64(e.task.Jitter))) }
+		t := time.NewTimer(d)
+		select {
+		case <- ctx.Done():
+			t.Stop()
+			return
+		case <- t.C:
+		}
+		s.run(ctx,e)
+	}
+}
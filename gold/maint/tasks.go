@@ -0,0 +1,57 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package maint
+
+import (
+	"github.com/maxymania/fastnntp-polyglot/gold"
+	"context"
+	"time"
+)
+
+/*
+Returns a task, that prunes a History.
+*/
+func HistoryTask(h gold.HistoryPruner, interval time.Duration) *Task {
+	return &Task{
+		Name: "history-prune",
+		Interval: interval,
+		Jitter: interval/10,
+		Run: func(ctx context.Context) error {
+			return h.HistoryPrune(uint64(time.Now().Unix()))
+		},
+	}
+}
+
+/*
+Returns a task, that calls f.
+*/
+func FuncTask(name string, interval time.Duration, f func()) *Task {
+	return &Task{
+		Name: name,
+		Interval: interval,
+		Jitter: interval/10,
+		Run: func(ctx context.Context) error { f(); return nil },
+	}
+}
@@ -0,0 +1,316 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package metrics
+
+import (
+	"github.com/maxymania/fastnntp-polyglot"
+	"github.com/maxymania/fastnntp-polyglot/gold"
+	"github.com/maxymania/fastnntp-polyglot/postauth"
+	"github.com/byte-mug/fastnntp/posting"
+	"time"
+)
+
+/*
+The label of a decorated backend. If R is nil, Default is used.
+*/
+type Label struct {
+	Name string
+	R    *Registry
+}
+func (l *Label) op(method string) *Op {
+	r := l.R
+	if r==nil { r = Default }
+	return r.Op(l.Name,method)
+}
+
+func objBytes(obj *newspolyglot.ArticleObject) int64 {
+	if obj==nil { return 0 }
+	return int64(len(obj.Head)+len(obj.Body))
+}
+func ovBytes(ov *newspolyglot.ArticleOverview) int64 {
+	if ov==nil { return 0 }
+	return int64(len(ov.Subject)+len(ov.From)+len(ov.Date)+len(ov.MsgId)+len(ov.Refs))
+}
+
+type GroupHeadCache struct {
+	Label
+	Inner newspolyglot.GroupHeadCache
+}
+func (d *GroupHeadCache) GroupHeadFilter(groups [][]byte) ([][]byte,error) {
+	t := time.Now()
+	r,err := d.Inner.GroupHeadFilter(groups)
+	d.op("GroupHeadFilter").Observe(t,err!=nil,err==nil && len(r)==0,0)
+	return r,err
+}
+
+type GroupHead struct {
+	Label
+	Inner newspolyglot.GroupHeadDB
+}
+func (d *GroupHead) GroupHeadInsert(groups [][]byte, buf []int64) ([]int64,error) {
+	t := time.Now()
+	r,err := d.Inner.GroupHeadInsert(groups,buf)
+	d.op("GroupHeadInsert").Observe(t,err!=nil,false,0)
+	return r,err
+}
+func (d *GroupHead) GroupHeadRevert(groups [][]byte, nums []int64) error {
+	t := time.Now()
+	err := d.Inner.GroupHeadRevert(groups,nums)
+	d.op("GroupHeadRevert").Observe(t,err!=nil,false,0)
+	return err
+}
+func (d *GroupHead) GroupHeadNeverReuse() bool {
+	m,ok := d.Inner.(newspolyglot.GroupHeadMonotonic)
+	return ok && m.GroupHeadNeverReuse()
+}
+
+type ArticlePosting struct {
+	Label
+	Inner newspolyglot.ArticlePostingDB
+}
+func (d *ArticlePosting) ArticlePostingPost(headp *posting.HeadInfo, body []byte, ngs [][]byte, numbs []int64) (rejected bool, failed bool, err error) {
+	t := time.Now()
+	rejected,failed,err = d.Inner.ArticlePostingPost(headp,body,ngs,numbs)
+	d.op("ArticlePostingPost").Observe(t,failed||err!=nil,rejected,0)
+	return
+}
+func (d *ArticlePosting) ArticlePostingCheckPost() (possible bool) {
+	t := time.Now()
+	possible = d.Inner.ArticlePostingCheckPost()
+	d.op("ArticlePostingCheckPost").Observe(t,false,!possible,0)
+	return
+}
+func (d *ArticlePosting) ArticlePostingCheckPostId(id []byte) (wanted bool, possible bool) {
+	t := time.Now()
+	wanted,possible = d.Inner.ArticlePostingCheckPostId(id)
+	d.op("ArticlePostingCheckPostId").Observe(t,false,!wanted,0)
+	return
+}
+
+type ArticleDirect struct {
+	Label
+	Inner newspolyglot.ArticleDirectDB
+}
+func (d *ArticleDirect) ArticleDirectStat(id []byte) bool {
+	t := time.Now()
+	r := d.Inner.ArticleDirectStat(id)
+	d.op("ArticleDirectStat").Observe(t,false,!r,0)
+	return r
+}
+func (d *ArticleDirect) ArticleDirectGet(id []byte, head, body bool) *newspolyglot.ArticleObject {
+	t := time.Now()
+	r := d.Inner.ArticleDirectGet(id,head,body)
+	d.op("ArticleDirectGet").Observe(t,false,r==nil,objBytes(r))
+	return r
+}
+func (d *ArticleDirect) ArticleDirectOverview(id []byte) *newspolyglot.ArticleOverview {
+	t := time.Now()
+	r := d.Inner.ArticleDirectOverview(id)
+	d.op("ArticleDirectOverview").Observe(t,false,r==nil,ovBytes(r))
+	return r
+}
+
+type ArticleGroup struct {
+	Label
+	Inner newspolyglot.ArticleGroupDB
+}
+func (d *ArticleGroup) ArticleGroupStat(group []byte, num int64, id_buf []byte) ([]byte, bool) {
+	t := time.Now()
+	id,ok := d.Inner.ArticleGroupStat(group,num,id_buf)
+	d.op("ArticleGroupStat").Observe(t,false,!ok,0)
+	return id,ok
+}
+func (d *ArticleGroup) ArticleGroupGet(group []byte, num int64, head, body bool, id_buf []byte) ([]byte, *newspolyglot.ArticleObject) {
+	t := time.Now()
+	id,obj := d.Inner.ArticleGroupGet(group,num,head,body,id_buf)
+	d.op("ArticleGroupGet").Observe(t,false,obj==nil,objBytes(obj))
+	return id,obj
+}
+func (d *ArticleGroup) ArticleGroupOverview(group []byte, first, last int64, targ func(int64, *newspolyglot.ArticleOverview)) {
+	t := time.Now()
+	var n,bytes int64
+	d.Inner.ArticleGroupOverview(group,first,last,func(num int64, ov *newspolyglot.ArticleOverview) {
+		n++
+		bytes += ovBytes(ov)
+		targ(num,ov)
+	})
+	d.op("ArticleGroupOverview").Observe(t,false,n==0,bytes)
+}
+func (d *ArticleGroup) ArticleGroupMove(group []byte, i int64, backward bool, id_buf []byte) (ni int64, id []byte, ok bool) {
+	t := time.Now()
+	ni,id,ok = d.Inner.ArticleGroupMove(group,i,backward,id_buf)
+	d.op("ArticleGroupMove").Observe(t,false,!ok,0)
+	return
+}
+func (d *ArticleGroup) ArticleGroupList(group []byte, first, last int64, targ func(int64)) {
+	t := time.Now()
+	var n int64
+	d.Inner.ArticleGroupList(group,first,last,func(num int64) {
+		n++
+		targ(num)
+	})
+	d.op("ArticleGroupList").Observe(t,false,n==0,0)
+}
+
+type GroupRealtime struct {
+	Label
+	Inner newspolyglot.GroupRealtimeDB
+}
+func (d *GroupRealtime) GroupRealtimeQuery(group []byte) (number int64, low int64, high int64, ok bool) {
+	t := time.Now()
+	number,low,high,ok = d.Inner.GroupRealtimeQuery(group)
+	d.op("GroupRealtimeQuery").Observe(t,false,!ok,0)
+	return
+}
+func (d *GroupRealtime) GroupRealtimeList(targ func(group []byte, high, low int64, status byte)) bool {
+	t := time.Now()
+	ok := d.Inner.GroupRealtimeList(targ)
+	d.op("GroupRealtimeList").Observe(t,!ok,false,0)
+	return ok
+}
+
+type GroupStatic struct {
+	Label
+	Inner newspolyglot.GroupStaticDB
+}
+func (d *GroupStatic) GroupStaticList(targ func(group []byte, descr []byte)) bool {
+	t := time.Now()
+	ok := d.Inner.GroupStaticList(targ)
+	d.op("GroupStaticList").Observe(t,!ok,false,0)
+	return ok
+}
+
+/* gold */
+
+type ArticleGroupEX struct {
+	ArticleGroup
+	Inner gold.ArticleGroupEX
+}
+func NewArticleGroupEX(inner gold.ArticleGroupEX, name string, r *Registry) *ArticleGroupEX {
+	return &ArticleGroupEX{ArticleGroup{Label{name,r},inner},inner}
+}
+func (d *ArticleGroupEX) StoreArticleInfos(groups [][]byte, nums []int64, exp uint64, ov *newspolyglot.ArticleOverview) error {
+	t := time.Now()
+	err := d.Inner.StoreArticleInfos(groups,nums,exp,ov)
+	d.op("StoreArticleInfos").Observe(t,err!=nil,false,0)
+	return err
+}
+func (d *ArticleGroupEX) GroupRealtimeQuery(group []byte) (number int64, low int64, high int64, ok bool) {
+	t := time.Now()
+	number,low,high,ok = d.Inner.GroupRealtimeQuery(group)
+	d.op("GroupRealtimeQuery").Observe(t,false,!ok,0)
+	return
+}
+
+type ArticleDirectEX struct {
+	ArticleDirect
+	Inner gold.ArticleDirectEX
+}
+func NewArticleDirectEX(inner gold.ArticleDirectEX, name string, r *Registry) *ArticleDirectEX {
+	return &ArticleDirectEX{ArticleDirect{Label{name,r},inner},inner}
+}
+func (d *ArticleDirectEX) ArticleDirectStore(exp uint64, ov *newspolyglot.ArticleOverview, obj *newspolyglot.ArticleObject) error {
+	t := time.Now()
+	err := d.Inner.ArticleDirectStore(exp,ov,obj)
+	d.op("ArticleDirectStore").Observe(t,err!=nil,false,0)
+	return err
+}
+func (d *ArticleDirectEX) ArticleDirectRollback(id []byte) {
+	t := time.Now()
+	d.Inner.ArticleDirectRollback(id)
+	d.op("ArticleDirectRollback").Observe(t,false,false,0)
+}
+
+type GroupList struct {
+	Label
+	Inner gold.GroupListDB
+}
+func (d *GroupList) AddGroupDescr(group, descr []byte) error {
+	t := time.Now()
+	err := d.Inner.AddGroupDescr(group,descr)
+	d.op("AddGroupDescr").Observe(t,err!=nil,false,0)
+	return err
+}
+func (d *GroupList) AddGroupStatus(group []byte, status byte) error {
+	t := time.Now()
+	err := d.Inner.AddGroupStatus(group,status)
+	d.op("AddGroupStatus").Observe(t,err!=nil,false,0)
+	return err
+}
+func (d *GroupList) GroupHeadFilterWithAuth(rank postauth.AuthRank, groups [][]byte) ([][]byte, error) {
+	t := time.Now()
+	r,err := d.Inner.GroupHeadFilterWithAuth(rank,groups)
+	d.op("GroupHeadFilterWithAuth").Observe(t,err!=nil,err==nil && len(r)==0,0)
+	return r,err
+}
+func (d *GroupList) GroupBaseList(status, descr bool, targ func(group []byte, status byte, descr []byte)) bool {
+	t := time.Now()
+	ok := d.Inner.GroupBaseList(status,descr,targ)
+	d.op("GroupBaseList").Observe(t,!ok,false,0)
+	return ok
+}
+
+// Implement gold.Unwrapper.
+func (d *GroupHeadCache) Unwrap() interface{} { return d.Inner }
+func (d *GroupHead) Unwrap() interface{} { return d.Inner }
+func (d *ArticlePosting) Unwrap() interface{} { return d.Inner }
+func (d *ArticleDirect) Unwrap() interface{} { return d.Inner }
+func (d *ArticleGroup) Unwrap() interface{} { return d.Inner }
+func (d *GroupRealtime) Unwrap() interface{} { return d.Inner }
+func (d *GroupStatic) Unwrap() interface{} { return d.Inner }
+func (d *ArticleGroupEX) Unwrap() interface{} { return d.Inner }
+func (d *ArticleDirectEX) Unwrap() interface{} { return d.Inner }
+func (d *GroupList) Unwrap() interface{} { return d.Inner }
+
+// Implement gold.Rewrapper.
+func (d *ArticlePosting) Rewrap(i interface{}) interface{} { n := *d; n.Inner = i.(newspolyglot.ArticlePostingDB); return &n }
+func (d *ArticleGroup) Rewrap(i interface{}) interface{} { n := *d; n.Inner = i.(newspolyglot.ArticleGroupDB); return &n }
+func (d *GroupRealtime) Rewrap(i interface{}) interface{} { n := *d; n.Inner = i.(newspolyglot.GroupRealtimeDB); return &n }
+func (d *GroupStatic) Rewrap(i interface{}) interface{} { n := *d; n.Inner = i.(newspolyglot.GroupStaticDB); return &n }
+
+var _ newspolyglot.GroupHeadCache = (*GroupHeadCache)(nil)
+var _ newspolyglot.GroupHeadDB = (*GroupHead)(nil)
+var _ newspolyglot.ArticlePostingDB = (*ArticlePosting)(nil)
+var _ newspolyglot.ArticleDirectDB = (*ArticleDirect)(nil)
+var _ newspolyglot.ArticleGroupDB = (*ArticleGroup)(nil)
+var _ newspolyglot.GroupRealtimeDB = (*GroupRealtime)(nil)
+var _ newspolyglot.GroupStaticDB = (*GroupStatic)(nil)
+var _ gold.ArticleGroupEX = (*ArticleGroupEX)(nil)
+var _ gold.ArticleDirectEX = (*ArticleDirectEX)(nil)
+var _ gold.GroupListDB = (*GroupList)(nil)
+var _ gold.Unwrapper = (*GroupHeadCache)(nil)
+var _ gold.Unwrapper = (*GroupHead)(nil)
+var _ gold.Unwrapper = (*ArticlePosting)(nil)
+var _ gold.Unwrapper = (*ArticleDirect)(nil)
+var _ gold.Unwrapper = (*ArticleGroup)(nil)
+var _ gold.Unwrapper = (*GroupRealtime)(nil)
+var _ gold.Unwrapper = (*GroupStatic)(nil)
+var _ gold.Unwrapper = (*ArticleGroupEX)(nil)
+var _ gold.Unwrapper = (*ArticleDirectEX)(nil)
+var _ gold.Unwrapper = (*GroupList)(nil)
+var _ gold.Rewrapper = (*ArticlePosting)(nil)
+var _ gold.Rewrapper = (*ArticleGroup)(nil)
+var _ gold.Rewrapper = (*GroupRealtime)(nil)
+var _ gold.Rewrapper = (*GroupStatic)(nil)
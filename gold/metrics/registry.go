@@ -0,0 +1,175 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+Metrics for backends.
+
+The decorators in this package record the number of calls, errors, misses,
+the latency and the bytes served per backend and method. A Registry exposes
+them in the Prometheus text exposition format.
+*/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Upper bounds of the latency histogram buckets, in seconds.
+var Buckets = []float64{.0005,.001,.0025,.005,.01,.025,.05,.1,.25,.5,1,2.5,5,10}
+
+/*
+The metrics of one method of one backend.
+*/
+type Op struct {
+	Backend, Method string
+	
+	calls, errors, misses, bytes int64
+	sum     int64 // Nanoseconds.
+	buckets []int64
+}
+
+/*
+Records a call, that started at 'start'.
+*/
+func (o *Op) Observe(start time.Time, failed, miss bool, bytes int64) {
+	d := time.Since(start)
+	atomic.AddInt64(&o.calls,1)
+	if failed { atomic.AddInt64(&o.errors,1) }
+	if miss { atomic.AddInt64(&o.misses,1) }
+	if bytes>0 { atomic.AddInt64(&o.bytes,bytes) }
+	atomic.AddInt64(&o.sum,int64(d))
+	s := d.Seconds()
+	for i,le := range Buckets {
+		if s<=le { atomic.AddInt64(&o.buckets[i],1); break }
+	}
+}
+
+// Adds to the bytes served, without counting a call.
+func (o *Op) AddBytes(n int64) { atomic.AddInt64(&o.bytes,n) }
+
+type key struct{ backend, method string }
+
+type Registry struct {
+	// Prefix of the metric names, defaults to "polyglot_backend".
+	Prefix string
+	
+	mu  sync.RWMutex
+	ops map[key]*Op
+}
+
+func NewRegistry() *Registry {
+	return &Registry{ops:make(map[key]*Op)}
+}
+
+// The Registry used by the decorators, if none is configured.
+var Default = NewRegistry()
+
+/*
+Returns the Op for the given backend and method, creating it, if necessary.
+*/
+func (r *Registry) Op(backend, method string) *Op {
+	k := key{backend,method}
+	r.mu.RLock()
+	o := r.ops[k]
+	r.mu.RUnlock()
+	if o!=nil { return o }
+	r.mu.Lock(); defer r.mu.Unlock()
+	if o = r.ops[k]; o==nil {
+		o = &Op{Backend:backend,Method:method,buckets:make([]int64,len(Buckets))}
+		r.ops[k] = o
+	}
+	return o
+}
+
+func (r *Registry) prefix() string {
+	if r.Prefix=="" { return "polyglot_backend" }
+	return r.Prefix
+}
+
+func (r *Registry) sorted() []*Op {
+	r.mu.RLock()
+	ops := make([]*Op,0,len(r.ops))
+	for _,o := range r.ops { ops = append(ops,o) }
+	r.mu.RUnlock()
+	sort.Slice(ops,func(i,j int) bool {
+		if ops[i].Backend!=ops[j].Backend { return ops[i].Backend<ops[j].Backend }
+		return ops[i].Method<ops[j].Method
+	})
+	return ops
+}
+
+var labelEscaper = strings.NewReplacer(`\`,`\\`,`"`,`\"`,"\n",`\n`)
+
+func labels(o *Op, extra string) string {
+	s := `backend="`+labelEscaper.Replace(o.Backend)+`",method="`+labelEscaper.Replace(o.Method)+`"`
+	if extra!="" { s += ","+extra }
+	return "{"+s+"}"
+}
+
+func float(f float64) string { return strconv.FormatFloat(f,'g',-1,64) }
+
+/*
+Writes all metrics in the Prometheus text exposition format.
+*/
+func (r *Registry) WriteTo(bw *bufio.Writer) error {
+	ops := r.sorted()
+	p := r.prefix()
+	counter := func(name, help string, get func(o *Op) int64) {
+		fmt.Fprintf(bw,"# HELP %s_%s %s\n# TYPE %s_%s counter\n",p,name,help,p,name)
+		for _,o := range ops {
+			fmt.Fprintf(bw,"%s_%s%s %d\n",p,name,labels(o,""),get(o))
+		}
+	}
+	counter("calls_total","Number of calls.",func(o *Op) int64 { return atomic.LoadInt64(&o.calls) })
+	counter("errors_total","Number of failed calls.",func(o *Op) int64 { return atomic.LoadInt64(&o.errors) })
+	counter("misses_total","Number of calls, that found nothing.",func(o *Op) int64 { return atomic.LoadInt64(&o.misses) })
+	counter("bytes_total","Number of bytes served.",func(o *Op) int64 { return atomic.LoadInt64(&o.bytes) })
+	
+	fmt.Fprintf(bw,"# HELP %s_latency_seconds Latency of the calls.\n# TYPE %s_latency_seconds histogram\n",p,p)
+	for _,o := range ops {
+		var cum int64
+		for i,le := range Buckets {
+			cum += atomic.LoadInt64(&o.buckets[i])
+			fmt.Fprintf(bw,"%s_latency_seconds_bucket%s %d\n",p,labels(o,`le="`+float(le)+`"`),cum)
+		}
+		calls := atomic.LoadInt64(&o.calls)
+		fmt.Fprintf(bw,"%s_latency_seconds_bucket%s %d\n",p,labels(o,`le="+Inf"`),calls)
+		fmt.Fprintf(bw,"%s_latency_seconds_sum%s %s\n",p,labels(o,""),float(time.Duration(atomic.LoadInt64(&o.sum)).Seconds()))
+		fmt.Fprintf(bw,"%s_latency_seconds_count%s %d\n",p,labels(o,""),calls)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type","text/plain; version=0.0.4")
+	r.WriteTo(bufio.NewWriter(w))
+}
@@ -29,6 +29,7 @@ package gold
 import "github.com/maxymania/fastnntp-polyglot"
 import "github.com/maxymania/fastnntp-polyglot/postauth"
 import "github.com/byte-mug/fastnntp/posting"
+import "github.com/maxymania/fastnntp-polyglot/gold/journal"
 
 type ArticleGroupEX interface {
 	newspolyglot.ArticleGroupDB
@@ -101,6 +102,12 @@ type PostingImpl struct {
 	Dir    ArticleDirectEX
 	
 	Policy PostingPolicyLite
+	
+	// Optional: Remembers the Message-IDs of expired articles.
+	History HistoryDB
+	
+	// Optional: Records the steps of every posting.
+	Journal *journal.Journal
 }
 func (p *PostingImpl) ArticlePostingCheckPost() (possible bool) {
 	return p.Policy!=nil
@@ -108,6 +115,7 @@ func (p *PostingImpl) ArticlePostingCheckPost() (possible bool) {
 func (p *PostingImpl) ArticlePostingCheckPostId(id []byte) (wanted bool, possible bool) {
 	possible = p.Policy!=nil
 	wanted = !p.Dir.ArticleDirectStat(id)
+	if wanted && p.History!=nil { wanted = !p.History.HistoryLookup(id) }
 	return
 }
 
@@ -135,12 +143,23 @@ func (p *PostingImpl) ArticlePostingPost(headp *posting.HeadInfo, body []byte, n
 	err = p.Dir.ArticleDirectStore(exp, ov,obj)
 	if err!=nil { failed = true; return }
 	
+	// A recovery keeps the article and the numbers, once index entries may exist.
+	err = p.Journal.Mark(ov.MsgId,journal.StepStored|journal.StepIndexing)
+	if err!=nil {
+		failed = true
+		p.Dir.ArticleDirectRollback(ov.MsgId)
+		return
+	}
+	
 	err = p.Grp.StoreArticleInfos(ngs, numbs, exp, ov)
 	if err!=nil {
 		failed = true
 		p.Dir.ArticleDirectRollback(ov.MsgId)
 		return
 	}
+	p.Journal.Mark(ov.MsgId,journal.StepIndexed)
+	
+	if p.History!=nil { p.History.HistoryRemember(ov.MsgId,exp) }
 	
 	return
 }
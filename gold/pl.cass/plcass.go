@@ -0,0 +1,81 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+Cluster-wide postlock.Locker using Cassandra lightweight transactions.
+*/
+package plcass
+
+import "github.com/gocql/gocql"
+import "github.com/maxymania/fastnntp-polyglot/gold/postlock"
+import "sync"
+
+func Initialize(session *gocql.Session) {
+	session.Query(`
+	CREATE TABLE IF NOT EXISTS postlocks (
+		msgid blob PRIMARY KEY,
+		owner uuid
+	)
+	`).Exec()
+}
+
+type Locker struct {
+	Session *gocql.Session
+	
+	// Locks expire after TTL seconds, in case the holder crashed.
+	// Defaults to 300.
+	TTL int
+	
+	once  sync.Once
+	owner gocql.UUID
+	err   error
+}
+
+func (l *Locker) init() {
+	l.owner,l.err = gocql.RandomUUID()
+}
+
+func (l *Locker) ttl() int {
+	if l.TTL<=0 { return 300 }
+	return l.TTL
+}
+
+func (l *Locker) TryLock(id []byte) (bool,error) {
+	l.once.Do(l.init)
+	if l.err!=nil { return false,l.err }
+	return l.Session.Query(`
+	INSERT INTO postlocks (msgid,owner) VALUES (?,?) IF NOT EXISTS USING TTL ?
+	`,id,l.owner,l.ttl()).MapScanCAS(make(map[string]interface{}))
+}
+
+func (l *Locker) Unlock(id []byte) error {
+	l.once.Do(l.init)
+	if l.err!=nil { return l.err }
+	_,err := l.Session.Query(`
+	DELETE FROM postlocks WHERE msgid = ? IF owner = ?
+	`,id,l.owner).MapScanCAS(make(map[string]interface{}))
+	return err
+}
+
+var _ postlock.Locker = (*Locker)(nil)
@@ -0,0 +1,71 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+Single-flight guard for postings, keyed by Message-ID.
+
+If two peers feed the same article at the same time, only the first one gets
+the lock, the second one is rejected as a duplicate.
+*/
+package postlock
+
+import "sync"
+
+type Locker interface {
+	// Tries to lock the Message-ID. Returns false, if it is already locked.
+	TryLock(id []byte) (ok bool, err error)
+	
+	// Unlocks the Message-ID.
+	Unlock(id []byte) error
+}
+
+/*
+In-process Locker.
+*/
+type Memory struct {
+	mu   sync.Mutex
+	held map[string]struct{}
+}
+
+func NewMemory() *Memory {
+	return &Memory{held:make(map[string]struct{})}
+}
+
+func (m *Memory) TryLock(id []byte) (bool,error) {
+	m.mu.Lock(); defer m.mu.Unlock()
+	if _,ok := m.held[string(id)]; ok { return false,nil }
+	m.held[string(id)] = struct{}{}
+	return true,nil
+}
+
+func (m *Memory) Unlock(id []byte) error {
+	m.mu.Lock(); defer m.mu.Unlock()
+	delete(m.held,string(id))
+	return nil
+}
+
+// The process-wide Locker, used if no other Locker is configured.
+var Default Locker = NewMemory()
+
+var _ Locker = (*Memory)(nil)
@@ -0,0 +1,57 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package rebuild
+
+import "io/ioutil"
+import "os"
+
+type Checkpoint interface {
+	// Returns the saved cursor, or nil if there is none.
+	Load() ([]byte,error)
+	// Saves the cursor. A nil cursor marks the rebuild as done.
+	Save(cursor []byte) error
+}
+
+// A Checkpoint backed by a file.
+type FileCheckpoint string
+
+func (f FileCheckpoint) Load() ([]byte,error) {
+	data,err := ioutil.ReadFile(string(f))
+	if os.IsNotExist(err) { return nil,nil }
+	if len(data)==0 { data = nil }
+	return data,err
+}
+func (f FileCheckpoint) Save(cursor []byte) error {
+	if cursor==nil {
+		err := os.Remove(string(f))
+		if os.IsNotExist(err) { err = nil }
+		return err
+	}
+	tmp := string(f)+".tmp"
+	if err := ioutil.WriteFile(tmp,cursor,0644); err!=nil { return err }
+	return os.Rename(tmp,string(f))
+}
+
+var _ Checkpoint = FileCheckpoint("")
@@ -0,0 +1,88 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package rebuild
+
+import "bytes"
+
+/*
+Returns the (unfolded) value of the first header field named 'name' in the raw
+article head.
+*/
+func HeaderValue(head []byte, name string) []byte {
+	var val []byte
+	found := false
+	for len(head)>0 {
+		var line []byte
+		if i := bytes.IndexByte(head,'\n'); i<0 {
+			line,head = head,nil
+		} else {
+			line,head = head[:i],head[i+1:]
+		}
+		line = bytes.TrimRight(line,"\r")
+		if len(line)>0 && (line[0]==' ' || line[0]=='\t') {
+			// Continuation line.
+			if found { val = append(append(val,' '),bytes.TrimSpace(line)...) }
+			continue
+		}
+		if found { break }
+		i := bytes.IndexByte(line,':')
+		if i<0 || !bytes.EqualFold(line[:i],[]byte(name)) { continue }
+		found = true
+		val = append(val,bytes.TrimSpace(line[i+1:])...)
+	}
+	return val
+}
+
+func parseNum(b []byte) (i int64, ok bool) {
+	if len(b)==0 { return }
+	for _,c := range b {
+		if c<'0' || c>'9' { return 0,false }
+		i = (i*10)+int64(c-'0')
+	}
+	return i,true
+}
+
+/*
+Parses the Xref header of a raw article head into groups and article numbers.
+If server is not empty, the Xref header is ignored, unless it has been
+written by this server (the first token), since the numbers of other servers
+are meaningless here.
+
+	Xref: server.example group.one:123 group.two:456
+*/
+func ParseXref(head []byte, server string) (groups [][]byte, nums []int64) {
+	fields := bytes.Fields(HeaderValue(head,"Xref"))
+	if len(fields)<2 { return }
+	if server!="" && !bytes.EqualFold(fields[0],[]byte(server)) { return }
+	for _,f := range fields[1:] {
+		i := bytes.LastIndexByte(f,':')
+		if i<1 { continue }
+		num,ok := parseNum(f[i+1:])
+		if !ok || num<1 { continue }
+		groups = append(groups,f[:i])
+		nums = append(nums,num)
+	}
+	return
+}
@@ -0,0 +1,216 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+Rebuilds the group index (an gold.ArticleGroupEX) from the articles stored in
+an article store (an gold.ArticleDirectEX), in case the group index got lost
+or corrupted.
+
+The article numbers are taken from the Xref header, if present. Otherwise new
+numbers are assigned using a GroupHeadDB, if one is given. After every step,
+the heads of the groups are advanced past the restored numbers, so that new
+postings do not get numbers, that are already in use.
+*/
+package rebuild
+
+import "github.com/maxymania/fastnntp-polyglot"
+import "github.com/maxymania/fastnntp-polyglot/gold"
+import "github.com/maxymania/fastnntp-polyglot/buffer"
+import "github.com/byte-mug/fastnntp/posting"
+import "context"
+import "errors"
+import "time"
+
+var ErrNoAdvance = errors.New("rebuild: Heads does not implement GroupHeadAdvancer")
+
+type Source interface {
+	newspolyglot.ArticleDirectDB
+	gold.ArticleDirectEnum
+}
+
+type Progress struct {
+	Scanned int64 // Articles seen.
+	Stored  int64 // Articles inserted into the group index.
+	Skipped int64 // Articles without (usable) groups or numbers.
+	Failed  int64 // Articles that could not be read or stored.
+	
+	// Position of the rebuild, can be used to resume it.
+	Cursor  []byte
+	Done    bool
+}
+
+type Rebuilder struct {
+	Source Source
+	Target gold.ArticleGroupEX
+	
+	// Optional: Assigns numbers to articles lacking an Xref header. It must
+	// implement newspolyglot.GroupHeadAdvancer (or wrap such an object, see
+	// gold.Unwrapper), as its heads are advanced past the numbers taken from
+	// Xref headers.
+	Heads  newspolyglot.GroupHeadDB
+	
+	// Optional: The server name in the Xref headers written by this server.
+	// If set, Xref headers of other servers are ignored.
+	Server string
+	
+	// Optional: Filters the groups of articles lacking an Xref header.
+	Filter newspolyglot.GroupHeadCache
+	
+	// Expiration for articles without a known expiration, defaults to 1000 days.
+	DefaultExpire time.Duration
+	
+	// Optional: Restricts the rebuild to articles matching this filter.
+	Select *gold.ArticleDirectFilter
+	
+	// Articles per step, defaults to 1024.
+	PageSize int
+	
+	// Optional: Persists the cursor after every step.
+	Checkpoint Checkpoint
+	
+	// Optional: Called after every step.
+	OnProgress func(p *Progress)
+}
+
+type job struct {
+	id  []byte
+	exp uint64
+}
+
+// The highest restored number per group.
+type heads map[string]int64
+
+func (h heads) add(groups [][]byte, nums []int64) {
+	for i,g := range groups {
+		if h[string(g)]<nums[i] { h[string(g)] = nums[i] }
+	}
+}
+func (h heads) advance(a newspolyglot.GroupHeadAdvancer) error {
+	if len(h)==0 { return nil }
+	groups := make([][]byte,0,len(h))
+	nums := make([]int64,0,len(h))
+	for g,n := range h {
+		groups = append(groups,[]byte(g))
+		nums = append(nums,n)
+	}
+	if err := a.GroupHeadAdvance(groups,nums); err!=nil { return err }
+	for g := range h { delete(h,g) }
+	return nil
+}
+
+/*
+Runs the rebuild, until it is done, an error occurs or ctx is cancelled.
+If a Checkpoint is configured, the rebuild resumes where it was interrupted.
+*/
+func (r *Rebuilder) Run(ctx context.Context) (err error) {
+	var adv newspolyglot.GroupHeadAdvancer
+	if r.Heads!=nil {
+		// Decorators (metrics, breaker, ...) don't forward GroupHeadAdvance.
+		adv,_ = gold.Find(r.Heads,func(i interface{}) bool {
+			_,ok := i.(newspolyglot.GroupHeadAdvancer)
+			return ok
+		}).(newspolyglot.GroupHeadAdvancer)
+		if adv==nil { return ErrNoAdvance }
+	}
+	p := new(Progress)
+	hs := make(heads)
+	if r.Checkpoint!=nil {
+		p.Cursor,err = r.Checkpoint.Load()
+		if err!=nil { return }
+	}
+	jobs := make([]job,0,r.pageSize())
+	for {
+		if err = ctx.Err(); err!=nil { return }
+		jobs = jobs[:0]
+		next,err := r.Source.ArticleDirectEnum(p.Cursor,r.pageSize(),r.Select,func(e *gold.ArticleDirectEntry) {
+			jobs = append(jobs,job{append([]byte(nil),e.MsgId...),e.Expires})
+		})
+		if err!=nil { return err }
+		for _,j := range jobs { r.perform(p,hs,j) }
+		
+		// Advance the heads, before the checkpoint moves past these articles.
+		if adv!=nil {
+			if err = hs.advance(adv); err!=nil { return err }
+		}
+		p.Cursor = next
+		p.Done = next==nil
+		if r.Checkpoint!=nil {
+			if err = r.Checkpoint.Save(next); err!=nil { return err }
+		}
+		if r.OnProgress!=nil { r.OnProgress(p) }
+		if p.Done { return nil }
+	}
+}
+
+func (r *Rebuilder) pageSize() int {
+	if r.PageSize<=0 { return 1024 }
+	return r.PageSize
+}
+
+func (r *Rebuilder) expires(exp uint64) uint64 {
+	if exp!=0 { return exp }
+	d := r.DefaultExpire
+	if d<=0 { d = 1000*24*time.Hour }
+	return uint64(time.Now().Add(d).Unix())
+}
+
+func (r *Rebuilder) perform(p *Progress, hs heads, j job) {
+	p.Scanned++
+	obj := r.Source.ArticleDirectGet(j.id,true,false)
+	if obj==nil { p.Failed++; return }
+	defer releaseObject(obj)
+	ov := r.Source.ArticleDirectOverview(j.id)
+	if ov==nil { p.Failed++; return }
+	defer newspolyglot.ReleaseArticleOverview(ov)
+	
+	groups,nums := ParseXref(obj.Head,r.Server)
+	if len(groups)==0 {
+		if r.Heads==nil { p.Skipped++; return }
+		groups = posting.SplitNewsgroups(HeaderValue(obj.Head,"Newsgroups"))
+		if r.Filter!=nil {
+			var err error
+			groups,err = r.Filter.GroupHeadFilter(groups)
+			if err!=nil { p.Failed++; return }
+		}
+		if len(groups)==0 { p.Skipped++; return }
+		var err error
+		nums,err = r.Heads.GroupHeadInsert(groups,nil)
+		if err!=nil { p.Failed++; return }
+		if r.Target.StoreArticleInfos(groups,nums,r.expires(j.exp),ov)!=nil {
+			r.Heads.GroupHeadRevert(groups,nums)
+			p.Failed++
+			return
+		}
+		p.Stored++
+		return
+	}
+	if r.Target.StoreArticleInfos(groups,nums,r.expires(j.exp),ov)!=nil { p.Failed++; return }
+	hs.add(groups,nums)
+	p.Stored++
+}
+
+func releaseObject(obj *newspolyglot.ArticleObject) {
+	for _,buf := range obj.Bufs { buffer.Put(buf) }
+	newspolyglot.ReleaseArticleObject(obj)
+}
@@ -0,0 +1,309 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package replay
+
+import (
+	"github.com/maxymania/fastnntp-polyglot"
+	"github.com/maxymania/fastnntp-polyglot/gold"
+	"github.com/byte-mug/fastnntp/posting"
+	"time"
+)
+
+func flags(head, body, backward bool) (f uint8) {
+	if head { f |= FlagHead }
+	if body { f |= FlagBody }
+	if backward { f |= FlagBackward }
+	return
+}
+func clone(b []byte) []byte {
+	if b==nil { return nil }
+	return append([]byte{},b...)
+}
+func objResult(rec *Record, obj *newspolyglot.ArticleObject) {
+	if obj==nil { return }
+	var d digest
+	rec.Ok = true
+	if (rec.Flags&FlagHead)!=0 { d.add(obj.Head) }
+	if (rec.Flags&FlagBody)!=0 { d.add(obj.Body) }
+	rec.Count = int64(len(obj.Head)+len(obj.Body))
+	rec.Digest = d.sum
+}
+func ovAdd(d *digest, num int64, ov *newspolyglot.ArticleOverview) {
+	if ov==nil { d.add(i64(num)); return }
+	d.add(i64(num),ov.Subject,ov.From,ov.Date,ov.MsgId,ov.Refs,i64(ov.Bytes),i64(ov.Lines))
+}
+
+type GroupHeadCache struct {
+	Inner newspolyglot.GroupHeadCache
+	R     *Recorder
+}
+func (d *GroupHeadCache) GroupHeadFilter(groups [][]byte) ([][]byte,error) {
+	if !d.R.sample() { return d.Inner.GroupHeadFilter(groups) }
+	rec := &Record{Method:"GroupHeadFilter"}
+	for _,g := range groups { rec.Groups = append(rec.Groups,clone(g)) }
+	t := time.Now()
+	r,err := d.Inner.GroupHeadFilter(groups)
+	var dg digest
+	for _,g := range r { dg.add(g) }
+	rec.Ok,rec.Count,rec.Digest = err==nil,dg.count,dg.sum
+	d.R.record(rec,t)
+	return r,err
+}
+
+/*
+Records the write-methods. They are never performed by the Replayer.
+*/
+type GroupHead struct {
+	Inner newspolyglot.GroupHeadDB
+	R     *Recorder
+}
+func (d *GroupHead) GroupHeadInsert(groups [][]byte, buf []int64) ([]int64, error) {
+	if !d.R.sample() { return d.Inner.GroupHeadInsert(groups,buf) }
+	rec := &Record{Method:"GroupHeadInsert"}
+	for _,g := range groups { rec.Groups = append(rec.Groups,clone(g)) }
+	t := time.Now()
+	nums,err := d.Inner.GroupHeadInsert(groups,buf)
+	rec.Ok,rec.Count = err==nil,int64(len(nums))
+	d.R.record(rec,t)
+	return nums,err
+}
+func (d *GroupHead) GroupHeadRevert(groups [][]byte, nums []int64) error {
+	if !d.R.sample() { return d.Inner.GroupHeadRevert(groups,nums) }
+	rec := &Record{Method:"GroupHeadRevert",Count:int64(len(nums))}
+	for _,g := range groups { rec.Groups = append(rec.Groups,clone(g)) }
+	t := time.Now()
+	err := d.Inner.GroupHeadRevert(groups,nums)
+	rec.Ok = err==nil
+	d.R.record(rec,t)
+	return err
+}
+
+/*
+Records all methods. ArticlePostingPost is recorded without the article, but
+with its size.
+*/
+type ArticlePosting struct {
+	Inner newspolyglot.ArticlePostingDB
+	R     *Recorder
+}
+func (d *ArticlePosting) ArticlePostingPost(headp *posting.HeadInfo, body []byte, ngs [][]byte, numbs []int64) (rejected bool, failed bool, err error) {
+	if !d.R.sample() { return d.Inner.ArticlePostingPost(headp,body,ngs,numbs) }
+	rec := &Record{Method:"ArticlePostingPost",Id:clone(headp.MessageId),Count:int64(len(headp.RAW)+len(body))}
+	for _,g := range ngs { rec.Groups = append(rec.Groups,clone(g)) }
+	t := time.Now()
+	rejected,failed,err = d.Inner.ArticlePostingPost(headp,body,ngs,numbs)
+	rec.Ok = !(rejected||failed||err!=nil)
+	if rejected { rec.R1 = 1 }
+	if failed || err!=nil { rec.R2 = 1 }
+	d.R.record(rec,t)
+	return
+}
+func (d *ArticlePosting) ArticlePostingCheckPost() (possible bool) {
+	if !d.R.sample() { return d.Inner.ArticlePostingCheckPost() }
+	rec := &Record{Method:"ArticlePostingCheckPost"}
+	t := time.Now()
+	possible = d.Inner.ArticlePostingCheckPost()
+	rec.Ok = possible
+	d.R.record(rec,t)
+	return
+}
+func (d *ArticlePosting) ArticlePostingCheckPostId(id []byte) (wanted bool, possible bool) {
+	if !d.R.sample() { return d.Inner.ArticlePostingCheckPostId(id) }
+	rec := &Record{Method:"ArticlePostingCheckPostId",Id:clone(id)}
+	t := time.Now()
+	wanted,possible = d.Inner.ArticlePostingCheckPostId(id)
+	rec.Ok = wanted
+	if possible { rec.R1 = 1 }
+	d.R.record(rec,t)
+	return
+}
+
+type ArticleDirect struct {
+	Inner newspolyglot.ArticleDirectDB
+	R     *Recorder
+}
+func (d *ArticleDirect) ArticleDirectStat(id []byte) bool {
+	if !d.R.sample() { return d.Inner.ArticleDirectStat(id) }
+	rec := &Record{Method:"ArticleDirectStat",Id:clone(id)}
+	t := time.Now()
+	ok := d.Inner.ArticleDirectStat(id)
+	rec.Ok = ok
+	d.R.record(rec,t)
+	return ok
+}
+func (d *ArticleDirect) ArticleDirectGet(id []byte, head, body bool) *newspolyglot.ArticleObject {
+	if !d.R.sample() { return d.Inner.ArticleDirectGet(id,head,body) }
+	rec := &Record{Method:"ArticleDirectGet",Id:clone(id),Flags:flags(head,body,false)}
+	t := time.Now()
+	obj := d.Inner.ArticleDirectGet(id,head,body)
+	objResult(rec,obj)
+	d.R.record(rec,t)
+	return obj
+}
+func (d *ArticleDirect) ArticleDirectOverview(id []byte) *newspolyglot.ArticleOverview {
+	if !d.R.sample() { return d.Inner.ArticleDirectOverview(id) }
+	rec := &Record{Method:"ArticleDirectOverview",Id:clone(id)}
+	t := time.Now()
+	ov := d.Inner.ArticleDirectOverview(id)
+	if ov!=nil {
+		var dg digest
+		ovAdd(&dg,0,ov)
+		rec.Ok,rec.Digest = true,dg.sum
+	}
+	d.R.record(rec,t)
+	return ov
+}
+
+type ArticleGroup struct {
+	Inner newspolyglot.ArticleGroupDB
+	R     *Recorder
+}
+func (d *ArticleGroup) ArticleGroupStat(group []byte, num int64, id_buf []byte) ([]byte, bool) {
+	if !d.R.sample() { return d.Inner.ArticleGroupStat(group,num,id_buf) }
+	rec := &Record{Method:"ArticleGroupStat",Group:clone(group),A:num}
+	t := time.Now()
+	id,ok := d.Inner.ArticleGroupStat(group,num,id_buf)
+	rec.Ok = ok
+	if ok { rec.RId = clone(id) }
+	d.R.record(rec,t)
+	return id,ok
+}
+func (d *ArticleGroup) ArticleGroupGet(group []byte, num int64, head, body bool, id_buf []byte) ([]byte, *newspolyglot.ArticleObject) {
+	if !d.R.sample() { return d.Inner.ArticleGroupGet(group,num,head,body,id_buf) }
+	rec := &Record{Method:"ArticleGroupGet",Group:clone(group),A:num,Flags:flags(head,body,false)}
+	t := time.Now()
+	id,obj := d.Inner.ArticleGroupGet(group,num,head,body,id_buf)
+	objResult(rec,obj)
+	if obj!=nil { rec.RId = clone(id) }
+	d.R.record(rec,t)
+	return id,obj
+}
+func (d *ArticleGroup) ArticleGroupOverview(group []byte, first, last int64, targ func(int64, *newspolyglot.ArticleOverview)) {
+	if !d.R.sample() { d.Inner.ArticleGroupOverview(group,first,last,targ); return }
+	rec := &Record{Method:"ArticleGroupOverview",Group:clone(group),A:first,B:last}
+	var dg digest
+	t := time.Now()
+	d.Inner.ArticleGroupOverview(group,first,last,func(num int64, ov *newspolyglot.ArticleOverview) {
+		ovAdd(&dg,num,ov)
+		targ(num,ov)
+	})
+	rec.Count,rec.Digest = dg.count,dg.sum
+	d.R.record(rec,t)
+}
+func (d *ArticleGroup) ArticleGroupMove(group []byte, i int64, backward bool, id_buf []byte) (ni int64, id []byte, ok bool) {
+	if !d.R.sample() { return d.Inner.ArticleGroupMove(group,i,backward,id_buf) }
+	rec := &Record{Method:"ArticleGroupMove",Group:clone(group),A:i,Flags:flags(false,false,backward)}
+	t := time.Now()
+	ni,id,ok = d.Inner.ArticleGroupMove(group,i,backward,id_buf)
+	rec.Ok = ok
+	if ok { rec.R1,rec.RId = ni,clone(id) }
+	d.R.record(rec,t)
+	return
+}
+func (d *ArticleGroup) ArticleGroupList(group []byte, first, last int64, targ func(int64)) {
+	if !d.R.sample() { d.Inner.ArticleGroupList(group,first,last,targ); return }
+	rec := &Record{Method:"ArticleGroupList",Group:clone(group),A:first,B:last}
+	var dg digest
+	t := time.Now()
+	d.Inner.ArticleGroupList(group,first,last,func(num int64) {
+		dg.add(i64(num))
+		targ(num)
+	})
+	rec.Count,rec.Digest = dg.count,dg.sum
+	d.R.record(rec,t)
+}
+
+type GroupRealtime struct {
+	Inner newspolyglot.GroupRealtimeDB
+	R     *Recorder
+}
+func (d *GroupRealtime) GroupRealtimeQuery(group []byte) (number int64, low int64, high int64, ok bool) {
+	if !d.R.sample() { return d.Inner.GroupRealtimeQuery(group) }
+	rec := &Record{Method:"GroupRealtimeQuery",Group:clone(group)}
+	t := time.Now()
+	number,low,high,ok = d.Inner.GroupRealtimeQuery(group)
+	rec.Ok = ok
+	if ok { rec.R1,rec.R2,rec.R3 = number,low,high }
+	d.R.record(rec,t)
+	return
+}
+func (d *GroupRealtime) GroupRealtimeList(targ func(group []byte, high, low int64, status byte)) bool {
+	if !d.R.sample() { return d.Inner.GroupRealtimeList(targ) }
+	rec := &Record{Method:"GroupRealtimeList"}
+	var dg digest
+	t := time.Now()
+	ok := d.Inner.GroupRealtimeList(func(group []byte, high, low int64, status byte) {
+		dg.add(group,i64(high),i64(low),[]byte{status})
+		targ(group,high,low,status)
+	})
+	rec.Ok,rec.Count,rec.Digest = ok,dg.count,dg.sum
+	d.R.record(rec,t)
+	return ok
+}
+
+type GroupStatic struct {
+	Inner newspolyglot.GroupStaticDB
+	R     *Recorder
+}
+func (d *GroupStatic) GroupStaticList(targ func(group []byte, descr []byte)) bool {
+	if !d.R.sample() { return d.Inner.GroupStaticList(targ) }
+	rec := &Record{Method:"GroupStaticList"}
+	var dg digest
+	t := time.Now()
+	ok := d.Inner.GroupStaticList(func(group []byte, descr []byte) {
+		dg.add(group,descr)
+		targ(group,descr)
+	})
+	rec.Ok,rec.Count,rec.Digest = ok,dg.count,dg.sum
+	d.R.record(rec,t)
+	return ok
+}
+
+// Implement gold.Unwrapper.
+func (d *GroupHeadCache) Unwrap() interface{} { return d.Inner }
+func (d *GroupHead) Unwrap() interface{} { return d.Inner }
+func (d *ArticlePosting) Unwrap() interface{} { return d.Inner }
+func (d *ArticleDirect) Unwrap() interface{} { return d.Inner }
+func (d *ArticleGroup) Unwrap() interface{} { return d.Inner }
+func (d *GroupRealtime) Unwrap() interface{} { return d.Inner }
+func (d *GroupStatic) Unwrap() interface{} { return d.Inner }
+
+// Implement gold.Rewrapper.
+func (d *ArticlePosting) Rewrap(i interface{}) interface{} { n := *d; n.Inner = i.(newspolyglot.ArticlePostingDB); return &n }
+func (d *ArticleGroup) Rewrap(i interface{}) interface{} { n := *d; n.Inner = i.(newspolyglot.ArticleGroupDB); return &n }
+func (d *GroupRealtime) Rewrap(i interface{}) interface{} { n := *d; n.Inner = i.(newspolyglot.GroupRealtimeDB); return &n }
+func (d *GroupStatic) Rewrap(i interface{}) interface{} { n := *d; n.Inner = i.(newspolyglot.GroupStaticDB); return &n }
+
+var _ gold.Unwrapper = (*GroupHeadCache)(nil)
+var _ gold.Unwrapper = (*GroupHead)(nil)
+var _ gold.Unwrapper = (*ArticlePosting)(nil)
+var _ gold.Unwrapper = (*ArticleDirect)(nil)
+var _ gold.Unwrapper = (*ArticleGroup)(nil)
+var _ gold.Unwrapper = (*GroupRealtime)(nil)
+var _ gold.Unwrapper = (*GroupStatic)(nil)
+var _ gold.Rewrapper = (*ArticlePosting)(nil)
+var _ gold.Rewrapper = (*ArticleGroup)(nil)
+var _ gold.Rewrapper = (*GroupRealtime)(nil)
+var _ gold.Rewrapper = (*GroupStatic)(nil)
@@ -0,0 +1,230 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+Captures calls against the newspolyglot interfaces into a compact file and
+replays them against another backend.
+
+The recording decorators in this package wrap the interfaces of the Caps
+(ArticleDirectDB, ArticleGroupDB, GroupRealtimeDB, GroupStaticDB,
+GroupHeadCache, GroupHeadDB and ArticlePostingDB) and write one
+msgpack-encoded Record per call: the method, its arguments, the duration and
+a digest of the results. Article contents are not stored, only their sizes
+and a digest, so the file stays small and does not leak articles.
+
+A Replayer reads such a file, performs every read-call against a Target and
+reports mismatching results and the latency of both backends per method.
+The write-methods (ArticlePostingPost, GroupHeadInsert/Revert) are never
+performed, as that would modify the target. Instead, they are skipped or
+checked with side-effect free calls (see WriteMode).
+This is meant to validate a migration (eg. from oldcassandra to gold/ag.cassm
+or from newbolt to gold/ad.pgbadge) against a real workload before cutting over.
+*/
+package replay
+
+import (
+	"bufio"
+	"github.com/vmihailenco/msgpack"
+	"hash/fnv"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Flags of a Record.
+const (
+	FlagHead = 1<<iota
+	FlagBody
+	FlagBackward
+)
+
+/*
+A recorded call.
+
+The meaning of A, B, R1..R3 depends on the method:
+
+	ArticleDirectStat(Id)                      Ok
+	ArticleDirectGet(Id,Flags)                 Ok, Count=size, Digest
+	ArticleDirectOverview(Id)                  Ok, Digest
+	ArticleGroupStat(Group,A)                  Ok, RId
+	ArticleGroupGet(Group,A,Flags)             Ok, RId, Count=size, Digest
+	ArticleGroupOverview(Group,A,B)            Count=entries, Digest
+	ArticleGroupMove(Group,A,Flags)            Ok, R1=ni, RId
+	ArticleGroupList(Group,A,B)                Count=entries, Digest
+	GroupRealtimeQuery(Group)                  Ok, R1=number, R2=low, R3=high
+	GroupRealtimeList()                        Ok, Count=entries, Digest
+	GroupStaticList()                          Ok, Count=entries, Digest
+	GroupHeadFilter(Groups)                    Ok=(err==nil), Count=entries, Digest
+	ArticlePostingCheckPost()                  Ok=possible
+	ArticlePostingCheckPostId(Id)              Ok=wanted, R1=possible
+	ArticlePostingPost(Id,Groups)              Ok=posted, R1=rejected, R2=failed, Count=size
+	GroupHeadInsert(Groups)                    Ok=(err==nil), Count=numbers
+	GroupHeadRevert(Groups)                    Ok=(err==nil), Count=numbers
+*/
+type Record struct {
+	_msgpack struct{} `msgpack:",asArray"`
+	
+	Seq    uint64
+	At     int64 // nanoseconds since the start of the recording.
+	Dur    int64 // nanoseconds.
+	Method string
+	
+	Group  []byte
+	Id     []byte
+	Groups [][]byte
+	A, B   int64
+	Flags  uint8
+	
+	Ok         bool
+	R1, R2, R3 int64
+	RId        []byte
+	Count      int64
+	Digest     uint64
+}
+
+// Returns true, if the results of r and o are equal.
+func (r *Record) SameResult(o *Record) bool {
+	if r.Ok!=o.Ok || r.R1!=o.R1 || r.R2!=o.R2 || r.R3!=o.R3 { return false }
+	if r.Count!=o.Count || r.Digest!=o.Digest { return false }
+	return string(r.RId)==string(o.RId)
+}
+
+/*
+Writes Records to a file. A Recorder is safe for concurrent use.
+*/
+type Recorder struct {
+	// If > 1, only every n-th call is recorded.
+	SampleEvery uint64
+	
+	mu    sync.Mutex
+	w     *bufio.Writer
+	enc   *msgpack.Encoder
+	c     io.Closer
+	start time.Time
+	calls uint64
+	seq   uint64
+	err   error
+	
+	hook  func(rec *Record)
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	r := &Recorder{w:bufio.NewWriter(w),start:time.Now()}
+	r.enc = msgpack.NewEncoder(r.w)
+	if c,ok := w.(io.Closer); ok { r.c = c }
+	return r
+}
+
+// Creates (or truncates) the file at path and records into it.
+func Create(path string) (*Recorder,error) {
+	f,err := os.Create(path)
+	if err!=nil { return nil,err }
+	return NewRecorder(f),nil
+}
+
+// Decides, whether the current call should be recorded.
+func (r *Recorder) sample() bool {
+	if r==nil { return false }
+	r.mu.Lock(); defer r.mu.Unlock()
+	if r.err!=nil { return false }
+	r.calls++
+	return r.SampleEvery<2 || (r.calls%r.SampleEvery)==0
+}
+
+func (r *Recorder) record(rec *Record, t time.Time) {
+	rec.Dur = int64(time.Since(t))
+	if r.hook!=nil { r.hook(rec); return }
+	r.mu.Lock(); defer r.mu.Unlock()
+	if r.err!=nil { return }
+	r.seq++
+	rec.Seq = r.seq
+	rec.At = int64(t.Sub(r.start))
+	r.err = r.enc.Encode(rec)
+}
+
+// Returns the first write error, if any. After an error, nothing is recorded.
+func (r *Recorder) Err() error {
+	r.mu.Lock(); defer r.mu.Unlock()
+	return r.err
+}
+
+// Flushes the buffered records.
+func (r *Recorder) Flush() error {
+	r.mu.Lock(); defer r.mu.Unlock()
+	if r.err!=nil { return r.err }
+	r.err = r.w.Flush()
+	return r.err
+}
+
+// Flushes the buffered records and closes the underlying writer, if it is an io.Closer.
+func (r *Recorder) Close() error {
+	err := r.Flush()
+	if r.c!=nil {
+		if e := r.c.Close(); err==nil { err = e }
+	}
+	return err
+}
+
+/*
+Reads Records from a file written by a Recorder.
+*/
+type Reader struct {
+	dec *msgpack.Decoder
+}
+func NewReader(r io.Reader) *Reader {
+	return &Reader{msgpack.NewDecoder(bufio.NewReader(r))}
+}
+
+// Reads the next Record. Returns io.EOF at the end of the file.
+func (r *Reader) Next() (*Record,error) {
+	rec := new(Record)
+	err := r.dec.Decode(rec)
+	if err!=nil { return nil,err }
+	return rec,nil
+}
+
+// Digest helpers.
+// List digests are order-independent (sum of per-entry hashes),
+// because backends do not agree on the order of lists.
+
+type digest struct {
+	sum   uint64
+	count int64
+}
+func (d *digest) add(parts ...[]byte) {
+	h := fnv.New64a()
+	for _,p := range parts {
+		h.Write(p)
+		h.Write([]byte{0})
+	}
+	d.sum += h.Sum64()
+	d.count++
+}
+
+func i64(i int64) []byte {
+	var b [8]byte
+	for j := range b { b[j] = byte(i>>uint(56-j*8)) }
+	return b[:]
+}
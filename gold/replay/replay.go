@@ -0,0 +1,255 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package replay
+
+import (
+	"fmt"
+	"github.com/maxymania/fastnntp-polyglot"
+	"github.com/maxymania/fastnntp-polyglot/caps"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+type MethodStats struct {
+	Calls, Mismatches int64
+	
+	// Sum and maximum of the recorded and replayed durations.
+	Recorded, Replayed       time.Duration
+	RecordedMax, ReplayedMax time.Duration
+}
+func (m *MethodStats) MeanRecorded() time.Duration {
+	if m.Calls==0 { return 0 }
+	return m.Recorded/time.Duration(m.Calls)
+}
+func (m *MethodStats) MeanReplayed() time.Duration {
+	if m.Calls==0 { return 0 }
+	return m.Replayed/time.Duration(m.Calls)
+}
+
+// A call, whose result differs from the recording.
+type Mismatch struct {
+	Want, Got *Record
+}
+func (m *Mismatch) String() string {
+	w,g := m.Want,m.Got
+	return fmt.Sprintf("#%d %s(%q,%q,%d,%d): want ok=%v r=%d/%d/%d id=%q n=%d d=%x; got ok=%v r=%d/%d/%d id=%q n=%d d=%x",
+		w.Seq,w.Method,w.Group,w.Id,w.A,w.B,
+		w.Ok,w.R1,w.R2,w.R3,w.RId,w.Count,w.Digest,
+		g.Ok,g.R1,g.R2,g.R3,g.RId,g.Count,g.Digest)
+}
+
+type Report struct {
+	Calls, Mismatches int64
+	
+	// Calls, that could not be replayed, because the Target lacks the interface
+	// or the method is unknown.
+	Skipped int64
+	
+	Methods map[string]*MethodStats
+	
+	// The first mismatches (up to Replayer.MaxSamples).
+	Samples []*Mismatch
+}
+
+// Writes a human readable summary.
+func (r *Report) Print(w io.Writer) {
+	fmt.Fprintf(w,"calls=%d mismatches=%d skipped=%d\n",r.Calls,r.Mismatches,r.Skipped)
+	names := make([]string,0,len(r.Methods))
+	for n := range r.Methods { names = append(names,n) }
+	sort.Strings(names)
+	fmt.Fprintf(w,"%-28s %8s %8s %12s %12s %12s %12s\n","method","calls","mismatch","rec-mean","rep-mean","rec-max","rep-max")
+	for _,n := range names {
+		m := r.Methods[n]
+		fmt.Fprintf(w,"%-28s %8d %8d %12v %12v %12v %12v\n",n,m.Calls,m.Mismatches,m.MeanRecorded(),m.MeanReplayed(),m.RecordedMax,m.ReplayedMax)
+	}
+	for _,s := range r.Samples { fmt.Fprintln(w,s) }
+}
+
+/*
+Defines, how the Replayer treats the recorded write-methods. The
+write-methods themselves are never performed.
+*/
+type WriteMode uint8
+const (
+	// The write-methods are skipped.
+	WritesSkip WriteMode = iota
+	
+	// For a Target, that does not hold the recorded postings: ArticlePostingPost
+	// is checked with ArticlePostingCheckPost/CheckPostId (the Target must
+	// accept, what has been posted and refuse, what has been rejected),
+	// GroupHeadInsert with GroupHeadFilter (the Target must carry the groups).
+	WritesAccepted
+	
+	// For a Target, that has been migrated after the recording: the articles,
+	// that have been posted successfully, must be there (ArticleDirectStat).
+	// GroupHeadInsert is checked like with WritesAccepted.
+	WritesPresent
+)
+
+/*
+Replays a recording against the backends of Target.
+
+The calls are performed sequentially. Write-methods are never invoked, see
+WriteMode.
+*/
+type Replayer struct {
+	Target *caps.Caps
+	
+	Writes WriteMode
+	
+	// If true, the calls are paced according to their recorded timestamps,
+	// accelerated by the factor Speed (<= 0 means 1).
+	Pace  bool
+	Speed float64
+	
+	// Maximum number of mismatches kept in Report.Samples. Defaults to 100.
+	MaxSamples int
+	
+	// Called on every mismatch, if not nil.
+	OnMismatch func(m *Mismatch)
+}
+
+func (p *Replayer) ReplayFile(path string) (*Report,error) {
+	f,err := os.Open(path)
+	if err!=nil { return nil,err }
+	defer f.Close()
+	return p.Replay(f)
+}
+
+func (p *Replayer) Replay(src io.Reader) (*Report,error) {
+	var got *Record
+	rd := &Recorder{hook:func(rec *Record){ got = rec }}
+	c := p.Target
+	var (
+		ghc *GroupHeadCache
+		post *ArticlePosting
+		ad *ArticleDirect
+		ag *ArticleGroup
+		gr *GroupRealtime
+		gs *GroupStatic
+	)
+	if c.GroupHeadCache!=nil { ghc = &GroupHeadCache{c.GroupHeadCache,rd} }
+	if c.ArticlePostingDB!=nil { post = &ArticlePosting{c.ArticlePostingDB,rd} }
+	if c.ArticleDirectDB!=nil { ad = &ArticleDirect{c.ArticleDirectDB,rd} }
+	if c.ArticleGroupDB!=nil { ag = &ArticleGroup{c.ArticleGroupDB,rd} }
+	if c.GroupRealtimeDB!=nil { gr = &GroupRealtime{c.GroupRealtimeDB,rd} }
+	if c.GroupStaticDB!=nil { gs = &GroupStatic{c.GroupStaticDB,rd} }
+	
+	limit := p.MaxSamples
+	if limit==0 { limit = 100 }
+	speed := p.Speed
+	if speed<=0 { speed = 1 }
+	
+	rep := &Report{Methods:make(map[string]*MethodStats)}
+	r := NewReader(src)
+	start := time.Now()
+	var buf []byte
+	for {
+		want,err := r.Next()
+		if err==io.EOF { break }
+		if err!=nil { return rep,err }
+		if p.Pace {
+			if d := time.Duration(float64(want.At)/speed)-time.Since(start); d>0 { time.Sleep(d) }
+		}
+		
+		got = nil
+		if w := p.write(want); w!=nil {
+			want,got = w[0],w[1]
+		}
+		head,body,back := (want.Flags&FlagHead)!=0,(want.Flags&FlagBody)!=0,(want.Flags&FlagBackward)!=0
+		switch {
+		case want.Method=="GroupHeadFilter" && ghc!=nil: ghc.GroupHeadFilter(want.Groups)
+		case want.Method=="ArticlePostingCheckPost" && post!=nil: post.ArticlePostingCheckPost()
+		case want.Method=="ArticlePostingCheckPostId" && post!=nil: post.ArticlePostingCheckPostId(want.Id)
+		case want.Method=="ArticleDirectStat" && ad!=nil: ad.ArticleDirectStat(want.Id)
+		case want.Method=="ArticleDirectGet" && ad!=nil: ad.ArticleDirectGet(want.Id,head,body)
+		case want.Method=="ArticleDirectOverview" && ad!=nil: ad.ArticleDirectOverview(want.Id)
+		case want.Method=="ArticleGroupStat" && ag!=nil: buf,_ = ag.ArticleGroupStat(want.Group,want.A,buf[:0])
+		case want.Method=="ArticleGroupGet" && ag!=nil: buf,_ = ag.ArticleGroupGet(want.Group,want.A,head,body,buf[:0])
+		case want.Method=="ArticleGroupOverview" && ag!=nil: ag.ArticleGroupOverview(want.Group,want.A,want.B,func(int64,*newspolyglot.ArticleOverview){})
+		case want.Method=="ArticleGroupMove" && ag!=nil: _,buf,_ = ag.ArticleGroupMove(want.Group,want.A,back,buf[:0])
+		case want.Method=="ArticleGroupList" && ag!=nil: ag.ArticleGroupList(want.Group,want.A,want.B,func(int64){})
+		case want.Method=="GroupRealtimeQuery" && gr!=nil: gr.GroupRealtimeQuery(want.Group)
+		case want.Method=="GroupRealtimeList" && gr!=nil: gr.GroupRealtimeList(func([]byte,int64,int64,byte){})
+		case want.Method=="GroupStaticList" && gs!=nil: gs.GroupStaticList(func([]byte,[]byte){})
+		}
+		if got==nil { rep.Skipped++; continue }
+		got.Seq = want.Seq
+		
+		m := rep.Methods[want.Method]
+		if m==nil { m = new(MethodStats); rep.Methods[want.Method] = m }
+		rep.Calls++
+		m.Calls++
+		wd,gd := time.Duration(want.Dur),time.Duration(got.Dur)
+		m.Recorded += wd
+		m.Replayed += gd
+		if m.RecordedMax<wd { m.RecordedMax = wd }
+		if m.ReplayedMax<gd { m.ReplayedMax = gd }
+		if want.SameResult(got) { continue }
+		
+		rep.Mismatches++
+		m.Mismatches++
+		mm := &Mismatch{want,got}
+		if len(rep.Samples)<limit { rep.Samples = append(rep.Samples,mm) }
+		if p.OnMismatch!=nil { p.OnMismatch(mm) }
+	}
+	return rep,nil
+}
+
+/*
+Checks a recorded write-call with side-effect free calls against the Target.
+Returns the expected and the actual result, or nil, if the call is skipped.
+Failed calls are skipped, as the failure is not a property of the call.
+*/
+func (p *Replayer) write(want *Record) []*Record {
+	if p.Writes==WritesSkip { return nil }
+	c := p.Target
+	w := &Record{Seq:want.Seq,Method:want.Method,Group:want.Group,Id:want.Id,Dur:want.Dur,Ok:want.Ok}
+	got := &Record{Seq:want.Seq,Method:want.Method}
+	t := time.Now()
+	switch want.Method {
+	case "ArticlePostingPost":
+		if want.R2!=0 { return nil }
+		switch {
+		case p.Writes==WritesPresent && c.ArticleDirectDB!=nil:
+			if !want.Ok { return nil }
+			got.Ok = c.ArticleDirectDB.ArticleDirectStat(want.Id)
+		case p.Writes==WritesAccepted && c.ArticlePostingDB!=nil:
+			wanted,possible := c.ArticlePostingDB.ArticlePostingCheckPostId(want.Id)
+			got.Ok = wanted && possible && c.ArticlePostingDB.ArticlePostingCheckPost()
+		default: return nil
+		}
+	case "GroupHeadInsert":
+		if !want.Ok || c.GroupHeadCache==nil { return nil }
+		r,err := c.GroupHeadCache.GroupHeadFilter(want.Groups)
+		got.Ok = err==nil && len(r)==len(want.Groups)
+	default:
+		return nil
+	}
+	got.Dur = int64(time.Since(t))
+	return []*Record{w,got}
+}
@@ -27,8 +27,39 @@ package setup
 //import "github.com/maxymania/fastnntp-polyglot"
 import "github.com/maxymania/fastnntp-polyglot/caps"
 import "github.com/maxymania/fastnntp-polyglot/gold"
+import "github.com/maxymania/fastnntp-polyglot/gold/breaker"
+import "github.com/maxymania/fastnntp-polyglot/gold/faults"
+import "github.com/maxymania/fastnntp-polyglot/gold/health"
+import "github.com/maxymania/fastnntp-polyglot/gold/journal"
+import "github.com/maxymania/fastnntp-polyglot/gold/maint"
+import "github.com/maxymania/fastnntp-polyglot/gold/metrics"
+import "github.com/maxymania/fastnntp-polyglot/gold/replay"
+import "github.com/maxymania/fastnntp-polyglot/gold/spool"
+import "errors"
+import "reflect"
+import "time"
 //import "github.com/maxymania/fastnntp-polyglot/postauth"
 
+var ErrNoPostingImpl = errors.New("setup: ArticlePostingDB is not a gold.PostingImpl")
+
+/*
+The Setup* functions find the gold wrappers, that have been set up by Setup(),
+behind the decorators of earlier Setup* calls, so they can be called in any
+order.
+*/
+func findWrapper(i interface{}) (w *gold.ArticleGroupWrapper) {
+	w,_ = gold.Find(i,func(j interface{}) bool { _,ok := j.(*gold.ArticleGroupWrapper); return ok }).(*gold.ArticleGroupWrapper)
+	return
+}
+func findRealtime(i interface{}) (g *gold.GroupRealtimeImpl) {
+	g,_ = gold.Find(i,func(j interface{}) bool { _,ok := j.(*gold.GroupRealtimeImpl); return ok }).(*gold.GroupRealtimeImpl)
+	return
+}
+func findStatic(i interface{}) (g *gold.GroupStaticImpl) {
+	g,_ = gold.Find(i,func(j interface{}) bool { _,ok := j.(*gold.GroupStaticImpl); return ok }).(*gold.GroupStaticImpl)
+	return
+}
+
 func Setup(
 	c *caps.Caps,
 	ad gold.ArticleDirectEX,
@@ -48,3 +79,189 @@ func Setup(
 	}
 }
 
+
+/*
+Attaches a History to the posting backend, that has been set up by Setup().
+*/
+func SetupHistory(c *caps.Caps, h gold.HistoryDB) {
+	if p := gold.FindPostingImpl(c.ArticlePostingDB); p!=nil { p.History = h }
+}
+/*
+Wraps the backends with metrics decorators, recording into r (or
+metrics.Default, if r is nil).
+*/
+func SetupMetrics(c *caps.Caps, r *metrics.Registry) {
+	if c.GroupHeadDB!=nil { c.GroupHeadDB = &metrics.GroupHead{metrics.Label{"group-head",r},c.GroupHeadDB} }
+	if c.GroupHeadCache!=nil { c.GroupHeadCache = &metrics.GroupHeadCache{metrics.Label{"group-head-cache",r},c.GroupHeadCache} }
+	if p := gold.FindPostingImpl(c.ArticlePostingDB); p!=nil {
+		p.Dir = metrics.NewArticleDirectEX(p.Dir,"article-direct",r)
+		p.Grp = metrics.NewArticleGroupEX(p.Grp,"article-group",r)
+	}
+	if c.ArticlePostingDB!=nil { c.ArticlePostingDB = &metrics.ArticlePosting{metrics.Label{"article-posting",r},c.ArticlePostingDB} }
+	if w := findWrapper(c.ArticleGroupDB); w!=nil {
+		w.ArticleGroupDB = &metrics.ArticleGroup{metrics.Label{"article-group",r},w.ArticleGroupDB}
+		w.Direct = &metrics.ArticleDirect{metrics.Label{"article-direct",r},w.Direct}
+	} else if c.ArticleGroupDB!=nil {
+		c.ArticleGroupDB = &metrics.ArticleGroup{metrics.Label{"article-group",r},c.ArticleGroupDB}
+	}
+	if c.ArticleDirectDB!=nil { c.ArticleDirectDB = &metrics.ArticleDirect{metrics.Label{"article-direct",r},c.ArticleDirectDB} }
+	if g := findRealtime(c.GroupRealtimeDB); g!=nil {
+		g.ArticleGroupEX = metrics.NewArticleGroupEX(g.ArticleGroupEX,"article-group",r)
+		g.List = &metrics.GroupList{metrics.Label{"group-list",r},g.List}
+	} else if c.GroupRealtimeDB!=nil {
+		c.GroupRealtimeDB = &metrics.GroupRealtime{metrics.Label{"group-realtime",r},c.GroupRealtimeDB}
+	}
+	if g := findStatic(c.GroupStaticDB); g!=nil {
+		g.List = &metrics.GroupList{metrics.Label{"group-list",r},g.List}
+	} else if c.GroupStaticDB!=nil {
+		c.GroupStaticDB = &metrics.GroupStatic{metrics.Label{"group-static",r},c.GroupStaticDB}
+	}
+}
+
+/*
+Wraps the backends of the Caps (and the parts of the gold wrappers) with
+fault-injection decorators. For testing only.
+*/
+func SetupFaults(c *caps.Caps, f *faults.Injector) {
+	if c.GroupHeadDB!=nil { c.GroupHeadDB = &faults.GroupHead{c.GroupHeadDB,f} }
+	if c.GroupHeadCache!=nil { c.GroupHeadCache = &faults.GroupHeadCache{c.GroupHeadCache,f} }
+	if p := gold.FindPostingImpl(c.ArticlePostingDB); p!=nil {
+		p.Dir = faults.NewArticleDirectEX(p.Dir,f)
+		p.Grp = faults.NewArticleGroupEX(p.Grp,f)
+	}
+	if c.ArticlePostingDB!=nil { c.ArticlePostingDB = &faults.ArticlePosting{c.ArticlePostingDB,f} }
+	if w := findWrapper(c.ArticleGroupDB); w!=nil {
+		w.ArticleGroupDB = &faults.ArticleGroup{w.ArticleGroupDB,f}
+		w.Direct = &faults.ArticleDirect{w.Direct,f}
+	} else if c.ArticleGroupDB!=nil {
+		c.ArticleGroupDB = &faults.ArticleGroup{c.ArticleGroupDB,f}
+	}
+	if c.ArticleDirectDB!=nil { c.ArticleDirectDB = &faults.ArticleDirect{c.ArticleDirectDB,f} }
+	if g := findRealtime(c.GroupRealtimeDB); g!=nil {
+		g.ArticleGroupEX = faults.NewArticleGroupEX(g.ArticleGroupEX,f)
+		g.List = &faults.GroupList{g.List,f}
+	} else if c.GroupRealtimeDB!=nil {
+		c.GroupRealtimeDB = &faults.GroupRealtime{c.GroupRealtimeDB,f}
+	}
+	if g := findStatic(c.GroupStaticDB); g!=nil {
+		g.List = &faults.GroupList{g.List,f}
+	} else if c.GroupStaticDB!=nil {
+		c.GroupStaticDB = &faults.GroupStatic{c.GroupStaticDB,f}
+	}
+}
+
+/*
+Records the calls against the interfaces of the Caps into r.
+See package replay.
+*/
+func SetupRecorder(c *caps.Caps, r *replay.Recorder) {
+	if c.GroupHeadDB!=nil { c.GroupHeadDB = &replay.GroupHead{c.GroupHeadDB,r} }
+	if c.GroupHeadCache!=nil { c.GroupHeadCache = &replay.GroupHeadCache{c.GroupHeadCache,r} }
+	if c.ArticlePostingDB!=nil { c.ArticlePostingDB = &replay.ArticlePosting{c.ArticlePostingDB,r} }
+	if c.ArticleDirectDB!=nil { c.ArticleDirectDB = &replay.ArticleDirect{c.ArticleDirectDB,r} }
+	if c.ArticleGroupDB!=nil { c.ArticleGroupDB = &replay.ArticleGroup{c.ArticleGroupDB,r} }
+	if c.GroupRealtimeDB!=nil { c.GroupRealtimeDB = &replay.GroupRealtime{c.GroupRealtimeDB,r} }
+	if c.GroupStaticDB!=nil { c.GroupStaticDB = &replay.GroupStatic{c.GroupStaticDB,r} }
+}
+
+/*
+Attaches a Journal to the Caps and the posting backend, that has been set up
+by Setup(), after recovering the postings, that have been interrupted.
+Returns ErrNoPostingImpl, if there is no such posting backend, as the steps
+of the postings could not be recorded then.
+*/
+func SetupJournal(c *caps.Caps, j *journal.Journal) error {
+	p := gold.FindPostingImpl(c.ArticlePostingDB)
+	if p==nil { return ErrNoPostingImpl }
+	p.Journal = j
+	c.Journal = j
+	return j.Recover(c.GroupHeadDB,p.Dir)
+}
+/*
+Puts a durable spool in directory 'dir' in front of the posting backends.
+Accepted articles are acknowledged, once they are on disk, and posted in the
+background. Call Stop() on the Spool on shutdown.
+*/
+func SetupSpool(c *caps.Caps, dir string) (*spool.Spool,error) {
+	s,err := spool.Open(dir,c)
+	if err!=nil { return nil,err }
+	c.Spool = s
+	s.Start()
+	return s,nil
+}
+/*
+Wraps the backends with circuit breakers, one per backend object. Postings
+are refused (read-only mode), while any backend on the write path is unhealthy.
+Returns the breakers, that have been created.
+*/
+func SetupBreakers(c *caps.Caps, cfg *breaker.Config) (all []*breaker.Breaker) {
+	bs := make(map[interface{}]*breaker.Breaker)
+	get := func(obj interface{}, name string) *breaker.Breaker {
+		comparable := reflect.TypeOf(obj).Comparable()
+		if comparable {
+			if b := bs[obj]; b!=nil { return b }
+		}
+		b := breaker.New(name,cfg)
+		if comparable { bs[obj] = b }
+		all = append(all,b)
+		return b
+	}
+	
+	var deps []*breaker.Breaker
+	if c.GroupHeadDB!=nil {
+		b := get(c.GroupHeadDB,"group-head")
+		deps = append(deps,b)
+		c.GroupHeadDB = &breaker.GroupHead{c.GroupHeadDB,b}
+	}
+	if c.GroupHeadCache!=nil {
+		c.GroupHeadCache = &breaker.GroupHeadCache{c.GroupHeadCache,get(c.GroupHeadCache,"group-head")}
+	}
+	if p := gold.FindPostingImpl(c.ArticlePostingDB); p!=nil {
+		bd := get(p.Dir,"article-direct")
+		bg := get(p.Grp,"article-group")
+		deps = append(deps,bd,bg)
+		p.Dir = breaker.NewArticleDirectEX(p.Dir,bd)
+		p.Grp = breaker.NewArticleGroupEX(p.Grp,bg)
+	}
+	if c.ArticlePostingDB!=nil {
+		c.ArticlePostingDB = &breaker.ArticlePosting{c.ArticlePostingDB,get(c.ArticlePostingDB,"article-posting"),deps}
+	}
+	if w := findWrapper(c.ArticleGroupDB); w!=nil {
+		w.ArticleGroupDB = &breaker.ArticleGroup{w.ArticleGroupDB,get(w.ArticleGroupDB,"article-group")}
+		w.Direct = &breaker.ArticleDirect{w.Direct,get(w.Direct,"article-direct")}
+	} else if c.ArticleGroupDB!=nil {
+		c.ArticleGroupDB = &breaker.ArticleGroup{c.ArticleGroupDB,get(c.ArticleGroupDB,"article-group")}
+	}
+	if c.ArticleDirectDB!=nil {
+		c.ArticleDirectDB = &breaker.ArticleDirect{c.ArticleDirectDB,get(c.ArticleDirectDB,"article-direct")}
+	}
+	if r := findRealtime(c.GroupRealtimeDB); r!=nil {
+		r.ArticleGroupEX = breaker.NewArticleGroupEX(r.ArticleGroupEX,get(r.ArticleGroupEX,"article-group"))
+	} else if c.GroupRealtimeDB!=nil {
+		c.GroupRealtimeDB = &breaker.GroupRealtime{c.GroupRealtimeDB,get(c.GroupRealtimeDB,"group-realtime")}
+	}
+	if c.GroupStaticDB!=nil {
+		c.GroupStaticDB = &breaker.GroupStatic{c.GroupStaticDB,get(c.GroupStaticDB,"group-static")}
+	}
+	return
+}
+
+/*
+Creates and starts a maintainance Scheduler with the tasks of all backends,
+that have been set up, and those in 'extra'. Backends that implement
+maint.Provider contribute their tasks, a History that is a gold.HistoryPruner
+is pruned hourly.
+
+Call Stop() on the Scheduler on shutdown.
+*/
+func SetupMaintainance(c *caps.Caps, extra ...interface{}) *maint.Scheduler {
+	s := new(maint.Scheduler)
+	for _,i := range health.Components(c,extra...) {
+		switch v := i.(type) {
+		case maint.Provider: s.RegisterProvider(v)
+		case gold.HistoryPruner: s.Register(maint.HistoryTask(v,time.Hour))
+		}
+	}
+	s.Start()
+	return s
+}
@@ -0,0 +1,425 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+Local durable spool for accepted articles.
+
+Articles are written to disk and acknowledged immediately. A background
+drainer posts them to the Target. An article, that fails, is retried with
+exponential backoff, after the other articles; so one article, that keeps
+failing, doesn't hold up the rest. While posting fails altogether (eg. the
+backends are unavailable), the drainer backs off as well. Articles, that are
+rejected, are dropped. Articles, that still fail after MaxAttempts tries, are
+moved into the dead-letter directory ("dead" inside the spool directory).
+*/
+package spool
+
+import (
+	"github.com/byte-mug/fastnntp/posting"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrCorrupt = errors.New("spool: corrupt file")
+
+var magic = []byte("NSP1")
+
+/*
+Posts an article. Implemented by *caps.Caps.
+*/
+type Target interface {
+	PostArticle(headp *posting.HeadInfo, body []byte) (rejected bool, failed bool)
+}
+
+type entry struct {
+	name     string
+	id       string
+	arrived  time.Time
+	attempts int
+	backoff  time.Duration
+	retryAt  time.Time
+}
+
+type Stats struct {
+	Depth     int
+	OldestAge time.Duration
+	Posted    int64
+	Rejected  int64
+	Retries   int64
+	Dead      int64
+}
+
+type Spool struct {
+	Target Target
+	
+	// Backoff between the retries of an article and between consecutive
+	// failures, defaults to 1 second and 5 minutes.
+	MinBackoff, MaxBackoff time.Duration
+	
+	// Failed attempts per article, before it is moved into the dead-letter
+	// directory. Defaults to 20. Attempts are counted since Open().
+	MaxAttempts int
+	
+	dir     string
+	mu      sync.Mutex
+	pending map[string]*entry
+	queue   []*entry
+	seq     uint64
+	stats   Stats
+	wake    chan struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+/*
+Opens the spool in directory 'dir'. Articles, that have been spooled before,
+are queued again. Call Start() to begin draining.
+*/
+func Open(dir string, t Target) (*Spool,error) {
+	if err := os.MkdirAll(dir,0700); err!=nil { return nil,err }
+	s := &Spool{Target:t,dir:dir,pending:make(map[string]*entry),wake:make(chan struct{},1)}
+	names,err := filepath.Glob(filepath.Join(dir,"*.msg"))
+	if err!=nil { return nil,err }
+	sort.Strings(names) // Names are ordered by arrival.
+	for _,name := range names {
+		headp,_,err := s.load(name)
+		if err!=nil {
+			os.Rename(name,name+".bad")
+			continue
+		}
+		e := &entry{name:name,id:string(headp.MessageId),arrived:time.Now()}
+		if st,err := os.Stat(name); err==nil { e.arrived = st.ModTime() }
+		s.pending[e.id] = e
+		s.queue = append(s.queue,e)
+	}
+	
+	// Remove leftovers of interrupted writes.
+	tmps,_ := filepath.Glob(filepath.Join(dir,"*.tmp"))
+	for _,name := range tmps { os.Remove(name) }
+	return s,nil
+}
+
+func (s *Spool) minBackoff() time.Duration {
+	if s.MinBackoff<=0 { return time.Second }
+	return s.MinBackoff
+}
+func (s *Spool) maxBackoff() time.Duration {
+	if s.MaxBackoff<=0 { return 5*time.Minute }
+	return s.MaxBackoff
+}
+func (s *Spool) grow(d time.Duration) time.Duration {
+	if d==0 { return s.minBackoff() }
+	if d *= 2; d>s.maxBackoff() { d = s.maxBackoff() }
+	return d
+}
+func (s *Spool) maxAttempts() int {
+	if s.MaxAttempts<=0 { return 20 }
+	return s.MaxAttempts
+}
+
+// Moves the file of an article, that can't be posted, into the dead-letter
+// directory.
+func (s *Spool) bury(name string) {
+	dead := filepath.Join(s.dir,"dead")
+	if os.MkdirAll(dead,0700)!=nil || os.Rename(name,filepath.Join(dead,filepath.Base(name)))!=nil {
+		os.Rename(name,name+".bad")
+	}
+}
+
+func appendField(b, f []byte) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	b = append(b,buf[:binary.PutUvarint(buf[:],uint64(len(f)))]...)
+	return append(b,f...)
+}
+func readField(b []byte) (f,rest []byte, err error) {
+	n,k := binary.Uvarint(b)
+	if k<=0 || uint64(len(b)-k)<n { return nil,nil,ErrCorrupt }
+	return b[k:k+int(n)],b[k+int(n):],nil
+}
+
+func encode(headp *posting.HeadInfo, body []byte) []byte {
+	b := append([]byte(nil),magic...)
+	for _,f := range [...][]byte{
+		headp.MessageId,
+		headp.Newsgroups,
+		headp.Subject,
+		headp.From,
+		headp.Date,
+		headp.References,
+		headp.RAW,
+		body,
+	} { b = appendField(b,f) }
+	return b
+}
+func decode(b []byte) (headp *posting.HeadInfo, body []byte, err error) {
+	if len(b)<len(magic) || string(b[:len(magic)])!=string(magic) { return nil,nil,ErrCorrupt }
+	b = b[len(magic):]
+	var f [8][]byte
+	for i := range f {
+		if f[i],b,err = readField(b); err!=nil { return }
+	}
+	headp = &posting.HeadInfo{
+		MessageId:  f[0],
+		Newsgroups: f[1],
+		Subject:    f[2],
+		From:       f[3],
+		Date:       f[4],
+		References: f[5],
+		RAW:        f[6],
+	}
+	body = f[7]
+	return
+}
+
+func (s *Spool) load(name string) (*posting.HeadInfo,[]byte,error) {
+	b,err := ioutil.ReadFile(name)
+	if err!=nil { return nil,nil,err }
+	return decode(b)
+}
+
+func syncDir(dir string) {
+	d,err := os.Open(dir)
+	if err!=nil { return }
+	d.Sync()
+	d.Close()
+}
+
+func (s *Spool) SpoolHas(id []byte) bool {
+	s.mu.Lock(); defer s.mu.Unlock()
+	_,ok := s.pending[string(id)]
+	return ok
+}
+
+/*
+Writes the article to disk. Returns, after the file has been synced.
+*/
+func (s *Spool) SpoolPost(headp *posting.HeadInfo, body []byte) (bool,error) {
+	s.mu.Lock()
+	if _,ok := s.pending[string(headp.MessageId)]; ok { s.mu.Unlock(); return false,nil }
+	now := time.Now()
+	s.seq++
+	e := &entry{
+		name: filepath.Join(s.dir,fmt.Sprintf("%016x-%08x.msg",now.UnixNano(),s.seq&0xffffffff)),
+		id: string(headp.MessageId),
+		arrived: now,
+	}
+	s.pending[e.id] = e // Reserve the Message-ID.
+	s.mu.Unlock()
+	
+	err := s.write(e.name,encode(headp,body))
+	
+	s.mu.Lock()
+	if err!=nil {
+		delete(s.pending,e.id)
+	} else {
+		s.queue = append(s.queue,e)
+	}
+	s.mu.Unlock()
+	if err!=nil { return false,err }
+	
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return true,nil
+}
+
+func (s *Spool) write(name string, data []byte) error {
+	tmp := strings.TrimSuffix(name,".msg")+".tmp"
+	f,err := os.OpenFile(tmp,os.O_CREATE|os.O_EXCL|os.O_WRONLY,0600)
+	if err!=nil { return err }
+	_,err = f.Write(data)
+	if err==nil { err = f.Sync() }
+	if e := f.Close(); err==nil { err = e }
+	if err==nil { err = os.Rename(tmp,name) }
+	if err!=nil {
+		os.Remove(tmp)
+		return err
+	}
+	syncDir(s.dir)
+	return nil
+}
+
+func (s *Spool) Stats() (st Stats) {
+	s.mu.Lock(); defer s.mu.Unlock()
+	st = s.stats
+	st.Depth = len(s.queue)
+	for _,e := range s.queue {
+		if age := time.Since(e.arrived); age>st.OldestAge { st.OldestAge = age }
+	}
+	return
+}
+
+// Number of articles in the spool.
+func (s *Spool) Depth() int { return s.Stats().Depth }
+
+// Age of the oldest article in the spool.
+func (s *Spool) OldestAge() time.Duration { return s.Stats().OldestAge }
+
+/*
+Starts the background drainer.
+*/
+func (s *Spool) Start() {
+	s.mu.Lock(); defer s.mu.Unlock()
+	if s.stop!=nil { return }
+	s.stop = make(chan struct{})
+	s.wg.Add(1)
+	go s.drain(s.stop)
+}
+
+/*
+Stops the background drainer. Articles, that are left, remain on disk.
+*/
+func (s *Spool) Stop() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+	if stop==nil { return }
+	close(stop)
+	s.wg.Wait()
+}
+
+func (s *Spool) sleep(stop chan struct{}, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <- stop: return false
+	case <- t.C: return true
+	}
+}
+
+// Waits for d (forever, if d is 0) or a new article. Returns false, if stopped.
+func (s *Spool) wait(stop chan struct{}, d time.Duration) bool {
+	var c <-chan time.Time
+	if d>0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		c = t.C
+	}
+	select {
+	case <- stop: return false
+	case <- s.wake: return true
+	case <- c: return true
+	}
+}
+
+/*
+Returns the first article in the queue, that is due. If there is none,
+returns the time until the next one is due (0 if the queue is empty).
+Must be called with s.mu held.
+*/
+func (s *Spool) due(now time.Time) (*entry,time.Duration) {
+	var wait time.Duration
+	for _,e := range s.queue {
+		d := e.retryAt.Sub(now)
+		if d<=0 { return e,0 }
+		if wait==0 || d<wait { wait = d }
+	}
+	return nil,wait
+}
+
+// Removes e from the queue. Must be called with s.mu held.
+func (s *Spool) unqueue(e *entry) {
+	for i,f := range s.queue {
+		if f!=e { continue }
+		copy(s.queue[i:],s.queue[i+1:])
+		s.queue[len(s.queue)-1] = nil
+		s.queue = s.queue[:len(s.queue)-1]
+		return
+	}
+}
+
+func (s *Spool) drain(stop chan struct{}) {
+	defer s.wg.Done()
+	
+	// Grows with consecutive failures, regardless of the article.
+	pause := time.Duration(0)
+	for {
+		s.mu.Lock()
+		e,wait := s.due(time.Now())
+		s.mu.Unlock()
+		
+		if e==nil {
+			if !s.wait(stop,wait) { return }
+			continue
+		}
+		
+		rej,fl,dead := false,false,false
+		headp,body,err := s.load(e.name)
+		if err!=nil {
+			// Unreadable: set it aside.
+			dead = true
+		} else {
+			rej,fl = s.Target.PostArticle(headp,body)
+		}
+		
+		if fl && !rej && !dead {
+			e.attempts++
+			if e.attempts<s.maxAttempts() {
+				e.backoff = s.grow(e.backoff)
+				pause = s.grow(pause)
+				s.mu.Lock()
+				s.stats.Retries++
+				e.retryAt = time.Now().Add(e.backoff)
+				s.unqueue(e)
+				s.queue = append(s.queue,e) // Let the others go first.
+				s.mu.Unlock()
+				if !s.sleep(stop,pause) { return }
+				continue
+			}
+			dead = true
+		}
+		pause = 0
+		if dead {
+			s.bury(e.name)
+		} else {
+			// Posted or rejected (eg. a duplicate): drop it.
+			os.Remove(e.name)
+		}
+		
+		s.mu.Lock()
+		s.unqueue(e)
+		delete(s.pending,e.id)
+		switch {
+		case dead: s.stats.Dead++
+		case rej: s.stats.Rejected++
+		default: s.stats.Posted++
+		}
+		s.mu.Unlock()
+		
+		select {
+		case <- stop: return
+		default:
+		}
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package spool
+
+import (
+	"github.com/byte-mug/fastnntp/posting"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeTarget struct {
+	mu     sync.Mutex
+	posted []string
+	tries  map[string]int
+}
+func (f *fakeTarget) PostArticle(headp *posting.HeadInfo, body []byte) (rejected bool, failed bool) {
+	id := string(headp.MessageId)
+	f.mu.Lock(); defer f.mu.Unlock()
+	f.tries[id]++
+	switch id {
+	case "<poison@x>": return false,true
+	case "<dup@x>": return true,false
+	case "<flaky@x>": if f.tries[id]<2 { return false,true }
+	}
+	f.posted = append(f.posted,id)
+	return false,false
+}
+
+func article(id string) *posting.HeadInfo {
+	return &posting.HeadInfo{MessageId:[]byte(id),Newsgroups:[]byte("a.b"),RAW:[]byte("Message-ID: "+id)}
+}
+
+func tempDir(t *testing.T) string {
+	dir,err := ioutil.TempDir("","spool")
+	if err!=nil { t.Fatal(err) }
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func waitEmpty(t *testing.T, s *Spool) {
+	deadline := time.Now().Add(5*time.Second)
+	for s.Depth()>0 {
+		if time.Now().After(deadline) { t.Fatalf("spool not drained: %+v",s.Stats()) }
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDrainAndDeadLetter(t *testing.T) {
+	dir := tempDir(t)
+	tg := &fakeTarget{tries:make(map[string]int)}
+	s,err := Open(dir,tg)
+	if err!=nil { t.Fatal(err) }
+	s.MinBackoff,s.MaxBackoff,s.MaxAttempts = time.Millisecond,5*time.Millisecond,3
+	
+	// The failing article comes first, it must not hold up the others.
+	for _,id := range []string{"<poison@x>","<ok1@x>","<dup@x>","<flaky@x>","<ok2@x>"} {
+		ok,err := s.SpoolPost(article(id),[]byte("body\r\n"))
+		if err!=nil || !ok { t.Fatalf("SpoolPost(%s): %v %v",id,ok,err) }
+	}
+	if ok,_ := s.SpoolPost(article("<ok1@x>"),nil); ok { t.Error("spooled a Message-ID twice") }
+	if !s.SpoolHas([]byte("<poison@x>")) { t.Error("SpoolHas: false") }
+	
+	s.Start()
+	waitEmpty(t,s)
+	s.Stop()
+	
+	st := s.Stats()
+	if st.Posted!=3 || st.Rejected!=1 || st.Dead!=1 { t.Errorf("stats %+v",st) }
+	if n := tg.tries["<poison@x>"]; n!=3 { t.Errorf("poison: %d attempts, want 3",n) }
+	if len(tg.posted)==0 || tg.posted[0]!="<ok1@x>" { t.Errorf("posted %v",tg.posted) }
+	
+	dead,_ := filepath.Glob(filepath.Join(dir,"dead","*.msg"))
+	if len(dead)!=1 { t.Errorf("%d dead letters, want 1",len(dead)) }
+	left,_ := filepath.Glob(filepath.Join(dir,"*.msg"))
+	if len(left)!=0 { t.Errorf("%d articles left in the spool",len(left)) }
+	if s.SpoolHas([]byte("<poison@x>")) { t.Error("SpoolHas after dead-lettering") }
+}
+
+func TestReopen(t *testing.T) {
+	dir := tempDir(t)
+	tg := &fakeTarget{tries:make(map[string]int)}
+	s,err := Open(dir,tg)
+	if err!=nil { t.Fatal(err) }
+	for _,id := range []string{"<a@x>","<b@x>"} {
+		if _,err := s.SpoolPost(article(id),[]byte("body\r\n")); err!=nil { t.Fatal(err) }
+	}
+	
+	// A corrupt file is set aside.
+	ioutil.WriteFile(filepath.Join(dir,"0000000000000000-00000000.msg"),[]byte("junk"),0600)
+	
+	s,err = Open(dir,tg)
+	if err!=nil { t.Fatal(err) }
+	if d := s.Depth(); d!=2 { t.Fatalf("depth %d after reopening, want 2",d) }
+	if !s.SpoolHas([]byte("<b@x>")) { t.Error("SpoolHas: false") }
+	s.Start()
+	waitEmpty(t,s)
+	s.Stop()
+	if len(tg.posted)!=2 || tg.posted[0]!="<a@x>" { t.Errorf("posted %v",tg.posted) }
+	bad,_ := filepath.Glob(filepath.Join(dir,"*.bad"))
+	if len(bad)!=1 { t.Errorf("%d bad files, want 1",len(bad)) }
+}
@@ -0,0 +1,107 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package gold
+
+/*
+Implemented by decorators (eg. from the breaker, metrics, replay and faults
+packages), that wrap another backend object. Unwrap returns the wrapped object.
+*/
+type Unwrapper interface {
+	Unwrap() interface{}
+}
+
+/*
+Follows the Unwrap chain starting at i (i included) and returns the first
+object, for which match returns true, or nil.
+*/
+func Find(i interface{}, match func(interface{}) bool) interface{} {
+	for i!=nil {
+		if match(i) { return i }
+		u,ok := i.(Unwrapper)
+		if !ok { break }
+		i = u.Unwrap()
+	}
+	return nil
+}
+
+/*
+Implemented by decorators, that can be copied with another wrapped object.
+Rewrap returns a copy of the decorator, that wraps i.
+*/
+type Rewrapper interface {
+	Unwrapper
+	Rewrap(i interface{}) interface{}
+}
+
+/*
+Follows the Unwrap chain starting at i (i included) and returns a copy of the
+chain, in which the first object, for which match returns true, is replaced
+by repl(object). The chain itself is not modified. Returns nil, if there is
+no such object, or if a decorator in front of it is not a Rewrapper.
+*/
+func Replace(i interface{}, match func(interface{}) bool, repl func(interface{}) interface{}) interface{} {
+	if i==nil { return nil }
+	if match(i) { return repl(i) }
+	r,ok := i.(Rewrapper)
+	if !ok { return nil }
+	n := Replace(r.Unwrap(),match,repl)
+	if n==nil { return nil }
+	return r.Rewrap(n)
+}
+
+/*
+Returns the PostingImpl, that is i or is wrapped by i, or nil.
+*/
+func FindPostingImpl(i interface{}) *PostingImpl {
+	p,_ := Find(i,func(j interface{}) bool { _,ok := j.(*PostingImpl); return ok }).(*PostingImpl)
+	return p
+}
+
+/*
+Returns the ArticleDirectEnum, that is i or is wrapped by i, or nil.
+Decorators don't implement optional interfaces like this one.
+*/
+func FindArticleDirectEnum(i interface{}) ArticleDirectEnum {
+	e,_ := Find(i,func(j interface{}) bool { _,ok := j.(ArticleDirectEnum); return ok }).(ArticleDirectEnum)
+	return e
+}
+
+/*
+Implemented by objects, that are composed of several backend objects (eg.
+PostingImpl). Parts returns them; unset ones may be nil.
+*/
+type Composite interface {
+	Parts() []interface{}
+}
+
+func (a *ArticleGroupWrapper) Parts() []interface{} { return []interface{}{a.ArticleGroupDB,a.Direct} }
+func (g *GroupRealtimeImpl) Parts() []interface{} { return []interface{}{g.ArticleGroupEX,g.List} }
+func (g *GroupStaticImpl) Parts() []interface{} { return []interface{}{g.List} }
+func (p *PostingImpl) Parts() []interface{} { return []interface{}{p.Grp,p.Dir,p.History} }
+
+var _ Composite = (*ArticleGroupWrapper)(nil)
+var _ Composite = (*GroupRealtimeImpl)(nil)
+var _ Composite = (*GroupStaticImpl)(nil)
+var _ Composite = (*PostingImpl)(nil)
@@ -53,6 +53,11 @@ func (g *GroupEntry) Rollback(i int64) {
 		g.Low2,g.High2,g.Count2 = 0,0,0
 	}
 }
+// Like Rollback, but never lowers the High-mark, so i is not issued again.
+func (g *GroupEntry) Release(i int64) {
+	if g.Low2==0 { return }
+	if g.Count2>0 { g.Count2-- }
+}
 func (g *GroupEntry) MoveDown() {
 	if g.Low2==0 { return }
 	if g.Low1==0 {
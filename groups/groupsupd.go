@@ -45,6 +45,9 @@ type GroupHeadActor struct{
 	keybuf  [256]interface{}
 	cache   map[string]*GroupEntry
 	backend BackendTable
+	
+	// If true, reverted numbers are never issued again.
+	NeverReuse bool
 }
 func NewGroupHeadActor(bt BackendTable) *GroupHeadActor {
 	gha := new(GroupHeadActor)
@@ -153,12 +156,17 @@ func (g *GroupHeadActor) GroupHeadRevert(groups [][]byte, nums []int64) error {
 	tab := g.tabbuf[:0]
 	for i,group := range groups {
 		ge := g.cache[string(group)]
-		ge.Rollback(nums[i])
+		if g.NeverReuse {
+			ge.Release(nums[i])
+		} else {
+			ge.Rollback(nums[i])
+		}
 		data,_ := msgpack.Marshal(ge)
 		tab = append(tab,TablePair{group,data})
 	}
 	return g.backend.SetPairs(tab)
 }
+func (g *GroupHeadActor) GroupHeadNeverReuse() bool { return g.NeverReuse }
 // This function exist for debug-purposes only.
 func (g *GroupHeadActor) HlStats(group []byte) (low,high,count int64,err error) {
 	g.Lock(); defer g.Unlock()
@@ -24,6 +24,7 @@ SOFTWARE.
 package groups
 
 import "bufio"
+import "context"
 import "encoding/binary"
 import "fmt"
 import "sync"
@@ -148,6 +149,9 @@ func (g *GhaServer) serveRequest() error {
 			e = g.Obj.GroupHeadRevert(grplist,numlist)
 			e = writeError(g.W,e) ; if e!=nil { return e }
 			return g.W.Flush()
+		case "Ping":
+			e = writeError(g.W,nil) ; if e!=nil { return e }
+			return g.W.Flush()
 	}
 	return fmt.Errorf("Unknown Command")
 }
@@ -158,6 +162,16 @@ type GhaClient struct{
 	W *bufio.Writer
 	ibuf [8*4]byte
 }
+func (g *GhaClient) Ping(ctx context.Context) error {
+	if e := ctx.Err(); e!=nil { return e }
+	g.Lock(); defer g.Unlock()
+	_,e := g.W.WriteString("Ping\x00") ; if e!=nil { return e }
+	e     = g.W.Flush() ; if e!=nil { return e }
+	//------------------------
+	sl,e := g.R.ReadSlice(0) ; if e!=nil { return e }
+	if len(sl)>1 { return fmt.Errorf("Abroad %q",sl[:len(sl)-1]) }
+	return nil
+}
 func (g *GhaClient) AdmCreateGroup(group []byte) int {
 	g.Lock(); defer g.Unlock()
 	if strDirty(group) { return 4 }
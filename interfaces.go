@@ -32,11 +32,43 @@ type GroupHeadCache interface{
 	GroupHeadFilter(groups [][]byte) ([][]byte,error)
 }
 
+/*
+Allocates article numbers.
+
+GroupHeadInsert returns one new number per group. GroupHeadRevert releases
+numbers, that have been allocated but not used (eg. because the posting
+failed). By default, an implementation may hand out released numbers again.
+An implementation that never does so, implements GroupHeadMonotonic.
+*/
 type GroupHeadDB interface{
 	GroupHeadInsert(groups [][]byte,buf []int64) ([]int64,error)
 	GroupHeadRevert(groups [][]byte,nums []int64) error
 }
 
+/*
+Optional interface of a GroupHeadDB.
+
+If GroupHeadNeverReuse() returns true, the numbers returned by GroupHeadInsert
+are strictly increasing per group, and a number is never returned twice, even
+if it has been released by GroupHeadRevert. Released numbers become gaps.
+This is required by clients, that remember read articles by their numbers.
+*/
+type GroupHeadMonotonic interface{
+	GroupHeadNeverReuse() bool
+}
+
+/*
+Optional interface of a GroupHeadDB.
+
+GroupHeadAdvance raises the head of every group in "groups" to at least the
+corresponding number in "nums", so that GroupHeadInsert never returns that
+number (or a lower one) for this group afterwards. This is used after articles
+have been restored with known numbers (eg. from their Xref header).
+*/
+type GroupHeadAdvancer interface{
+	GroupHeadAdvance(groups [][]byte,nums []int64) error
+}
+
 type ArticlePostingDB interface{
 	ArticlePostingPost(headp *posting.HeadInfo,body []byte, ngs [][]byte, numbs []int64) (rejected bool, failed bool,err error)
 	ArticlePostingCheckPost() (possible bool)
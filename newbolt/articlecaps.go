@@ -33,6 +33,7 @@ import "github.com/boltdb/bolt"
 type articleMetadata struct{
 	Refc int64
 	Nums map[string]int64
+	Arrv int64 // Arrival time (Unix time), 0 for older articles.
 }
 
 type articleOver struct{
@@ -0,0 +1,148 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package newbolt
+
+import "github.com/vmihailenco/msgpack"
+import "github.com/boltdb/bolt"
+import "github.com/maxymania/fastnntp-polyglot/gold"
+import "bytes"
+
+/*
+Enumerates the articles ordered by Message-ID. The cursor is the last Message-ID seen.
+The articles in this database do not expire, so e.Expires is always 0.
+*/
+func (a *Articledb) ArticleDirectEnum(cursor []byte, limit int, filter *gold.ArticleDirectFilter, targ func(e *gold.ArticleDirectEntry)) (next []byte, err error) {
+	if limit<=0 { limit = 1024 }
+	n := 0
+	err = a.DB.View(func(tx *bolt.Tx) error {
+		var e gold.ArticleDirectEntry
+		var am articleMetadata
+		arrival := filter.NeedArrival()
+		c := tx.Bucket(tARTMETA).Cursor()
+		var k,v []byte
+		if len(cursor)==0 {
+			k,v = c.First()
+		} else {
+			k,v = c.Seek(cursor)
+			if bytes.Equal(k,cursor) { k,v = c.Next() }
+		}
+		for ; len(k)>0 && n<limit ; k,v = c.Next() {
+			next = append(next[:0],k...)
+			n++
+			e.MsgId = k
+			e.Arrived = 0
+			if arrival {
+				am = articleMetadata{}
+				if msgpack.Unmarshal(v,&am)==nil && am.Arrv>0 { e.Arrived = uint64(am.Arrv) }
+			}
+			if filter.Match(&e) { targ(&e) }
+		}
+		return nil
+	})
+	if err!=nil { return cursor,err }
+	if n<limit { return nil,nil }
+	return
+}
+
+/*
+Regenerates the "grparts" bucket and the group counters in "grpnums" from the
+article metadata, which contains the article numbers of each article.
+
+The rebuild is performed in steps of up to 'limit' articles, each step in its
+own transaction. Pass nil as cursor to start a rebuild, which wipes the group
+index first. Pass the returned cursor to continue an interrupted rebuild.
+Returns a nil cursor, once the rebuild is complete.
+
+The high water marks are never lowered, so that no article number is reused.
+*/
+func (a *Articledb) RebuildGroupIndex(cursor []byte, limit int) (next []byte, err error) {
+	if limit<=0 { limit = 1024 }
+	if cursor==nil {
+		err = a.DB.Update(resetGroupIndex)
+		if err!=nil { return }
+		cursor = []byte{}
+	}
+	n := 0
+	err = a.DB.Update(func(tx *bolt.Tx) error {
+		arts := tx.Bucket(tGRPARTS)
+		nums := tx.Bucket(tGRPNUMS)
+		gi := new(groupInfo)
+		var am articleMetadata
+		c := tx.Bucket(tARTMETA).Cursor()
+		k,v := c.Seek(cursor)
+		if len(cursor)!=0 && bytes.Equal(k,cursor) { k,v = c.Next() }
+		for ; len(k)>0 && n<limit ; k,v = c.Next() {
+			next = append(next[:0],k...)
+			n++
+			am.Nums = nil
+			if msgpack.Unmarshal(v,&am)!=nil { continue }
+			for group,num := range am.Nums {
+				gbk := arts.Bucket([]byte(group))
+				if gbk==nil { continue } // Group has been removed.
+				if err := gbk.Put(encode64(num),k); err!=nil { return err }
+				
+				gv := nums.Get([]byte(group))
+				if len(gv)==0 { continue }
+				if msgpack.Unmarshal(gv,gi)!=nil { continue }
+				gi[0]++ // Number
+				if gi[1]==0 || gi[1]>num { gi[1] = num } // Low
+				if gi[2]<num { gi[2] = num } // High
+				gv,_ = msgpack.Marshal(gi)
+				if err := nums.Put([]byte(group),gv); err!=nil { return err }
+			}
+		}
+		return nil
+	})
+	if err!=nil { return cursor,err }
+	if n<limit { return nil,nil }
+	return
+}
+
+func resetGroupIndex(tx *bolt.Tx) error {
+	arts := tx.Bucket(tGRPARTS)
+	nums := tx.Bucket(tGRPNUMS)
+	gi := new(groupInfo)
+	var groups [][]byte
+	c := nums.Cursor()
+	for k,_ := c.First(); len(k)>0 ; k,_ = c.Next() {
+		groups = append(groups,append([]byte(nil),k...))
+	}
+	for _,group := range groups {
+		if msgpack.Unmarshal(nums.Get(group),gi)!=nil { continue }
+		gi[0] = 0 // Number
+		gi[1] = 0 // Low
+		gv,_ := msgpack.Marshal(gi)
+		if err := nums.Put(group,gv); err!=nil { return err }
+		
+		if arts.Bucket(group)!=nil {
+			if err := arts.DeleteBucket(group); err!=nil { return err }
+		}
+		if _,err := arts.CreateBucket(group); err!=nil { return err }
+	}
+	return nil
+}
+
+var _ gold.ArticleDirectEnum = (*Articledb)(nil)
@@ -27,6 +27,7 @@ package newbolt
 
 import "github.com/byte-mug/fastnntp/posting"
 import "github.com/vmihailenco/msgpack"
+import "time"
 
 import "github.com/boltdb/bolt"
 
@@ -81,6 +82,27 @@ func (a *Articledb) GroupHeadInsert(ngs [][]byte,buf []int64) ([]int64,error) {
 	})
 	return buf,err
 }
+func (a *Articledb) GroupHeadNeverReuse() bool { return a.NeverReuse }
+func (a *Articledb) GroupHeadAdvance(ngs [][]byte,numbs []int64) error {
+	return a.DB.Update(func(tx *bolt.Tx) error {
+		nums := tx.Bucket(tGRPNUMS)
+		gi := new(groupInfo)
+	
+		for i,group := range ngs {
+			v := nums.Get(group)
+			if len(v)==0 { continue }
+			if msgpack.Unmarshal(v,gi)!=nil { continue }
+			if gi[2] /* High */ >= numbs[i] { continue }
+		
+			if gi[1]==0 { gi[1] = 1 } // Low
+			gi[2] = numbs[i] // High
+		
+			v,_ = msgpack.Marshal(gi)
+			if err := nums.Put(group,v) ; err!=nil { return err } // Propagate error!
+		}
+		return nil
+	})
+}
 func (a *Articledb) GroupHeadRevert(ngs [][]byte,numbs []int64) error {
 	err := a.DB.Update(func(tx *bolt.Tx) error {
 		nums := tx.Bucket(tGRPNUMS)
@@ -92,7 +114,7 @@ func (a *Articledb) GroupHeadRevert(ngs [][]byte,numbs []int64) error {
 			if msgpack.Unmarshal(v,gi)!=nil { continue }
 		
 			gi[0]-- // Number
-			if gi[2] /* High */ == numbs[i] { gi[2]-- }
+			if !a.NeverReuse && gi[2] /* High */ == numbs[i] { gi[2]-- }
 			
 			if gi[1]<gi[2] { gi[1] = gi[2] }
 		
@@ -149,7 +171,7 @@ func (a *Articledb) ArticlePostingPost(headp *posting.HeadInfo,body []byte, ngs
 }
 
 func (a *articleTransaction) performPost(headp *posting.HeadInfo,body []byte, ngs [][]byte, numbs []int64) (rejected bool, failed bool) {
-	am := &articleMetadata{ Nums: make(map[string]int64) }
+	am := &articleMetadata{ Nums: make(map[string]int64), Arrv: time.Now().Unix() }
 	ao := &articleOver{}
 	
 	// Subject, From, Date, MsgId, Refs
@@ -29,6 +29,10 @@ import "github.com/boltdb/bolt"
 
 type Articledb struct{
 	DB *bolt.DB
+	
+	// If true, GroupHeadRevert never lowers the high-water mark, so that
+	// article numbers are never issued twice.
+	NeverReuse bool
 }
 
 type articleTransaction struct{
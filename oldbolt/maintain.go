@@ -0,0 +1,70 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package oldbolt
+
+import "github.com/vmihailenco/msgpack"
+import "github.com/boltdb/bolt"
+import "github.com/maxymania/fastnntp-polyglot/gold"
+import "bytes"
+
+/*
+Enumerates the articles ordered by Message-ID. The cursor is the last Message-ID seen.
+The articles in this database do not expire, so e.Expires is always 0.
+*/
+func (a *Wrapper) ArticleDirectEnum(cursor []byte, limit int, filter *gold.ArticleDirectFilter, targ func(e *gold.ArticleDirectEntry)) (next []byte, err error) {
+	if limit<=0 { limit = 1024 }
+	n := 0
+	err = a.DB.View(func(tx *bolt.Tx) error {
+		var e gold.ArticleDirectEntry
+		var am articleMetadata
+		arrival := filter.NeedArrival()
+		c := tx.Bucket(tARTMETA).Cursor()
+		var k,v []byte
+		if len(cursor)==0 {
+			k,v = c.First()
+		} else {
+			k,v = c.Seek(cursor)
+			if bytes.Equal(k,cursor) { k,v = c.Next() }
+		}
+		for ; len(k)>0 && n<limit ; k,v = c.Next() {
+			next = append(next[:0],k...)
+			n++
+			e.MsgId = k
+			e.Arrived = 0
+			if arrival {
+				am = articleMetadata{}
+				if msgpack.Unmarshal(v,&am)==nil && am.Arrv>0 { e.Arrived = uint64(am.Arrv) }
+			}
+			if filter.Match(&e) { targ(&e) }
+		}
+		return nil
+	})
+	if err!=nil { return cursor,err }
+	if n<limit { return nil,nil }
+	return
+}
+
+var _ gold.ArticleDirectEnum = (*Wrapper)(nil)
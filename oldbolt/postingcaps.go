@@ -27,6 +27,7 @@ package oldbolt
 
 import "github.com/byte-mug/fastnntp/posting"
 import "github.com/vmihailenco/msgpack"
+import "time"
 
 import "github.com/boltdb/bolt"
 
@@ -149,7 +150,7 @@ func (a *Wrapper) ArticlePostingPost(headp *posting.HeadInfo,body []byte, ngs []
 }
 
 func (a *articleTransaction) performPost(headp *posting.HeadInfo,body []byte, ngs [][]byte, numbs []int64) (rejected bool, failed bool) {
-	am := &articleMetadata{ Nums: make(map[string]int64) }
+	am := &articleMetadata{ Nums: make(map[string]int64), Arrv: time.Now().Unix() }
 	ao := &articleOver{}
 	
 	// Subject, From, Date, MsgId, Refs
@@ -28,12 +28,14 @@ import "github.com/byte-mug/fastnntp"
 
 
 func handleSTAT(s *server,args [][]byte) error {
+	p := Args{F:args}
 	a := &s.gls.AR.Article
-	a.MessageId = append(s.gls.ID[:0],getarg(args,1)...)
-	a.Group     = getarg(args,2)
-	a.Number    = argtoi64(args,3)
-	a.HasId     = argtrue(args,4)
-	a.HasNum    = argtrue(args,5)
+	a.MessageId = append(s.gls.ID[:0],p.Bytes(1)...)
+	a.Group     = p.Bytes(2)
+	a.Number    = p.Int(3)
+	a.HasId     = p.Bool(4)
+	a.HasNum    = p.Bool(5)
+	if p.Err!=nil { return s.syntax(p.Err) }
 	var ok bool
 	if s.rh.ArticleCaps==nil {
 		ok = false
@@ -44,14 +46,16 @@ func handleSTAT(s *server,args [][]byte) error {
 }
 
 func handleGET(s *server,args [][]byte) error {
+	p := Args{F:args}
 	a := &s.gls.AR.Article
-	a.MessageId = append(s.gls.ID[:0],getarg(args,1)...)
-	a.Group     = getarg(args,2)
-	a.Number    = argtoi64(args,3)
-	a.HasId     = argtrue(args,4)
-	a.HasNum    = argtrue(args,5)
-	head := argtrue(args,6)
-	body := argtrue(args,7)
+	a.MessageId = append(s.gls.ID[:0],p.Bytes(1)...)
+	a.Group     = p.Bytes(2)
+	a.Number    = p.Int(3)
+	a.HasId     = p.Bool(4)
+	a.HasNum    = p.Bool(5)
+	head := p.Bool(6)
+	body := p.Bool(7)
+	if p.Err!=nil { return s.syntax(p.Err) }
 	
 	if s.rh.ArticleCaps==nil || !(head||body) {
 		return s.b.writeSplit(false,"")
@@ -75,13 +79,15 @@ func (s *server) WriteEntry(num int64, subject, from, date, msgId, refs []byte,
 	return s.b.writeSplit(true,num,subject,from,date,msgId,refs,lng,lines)
 }
 func handleOVER(s *server,args [][]byte) error {
+	p := Args{F:args}
 	a := &s.gls.AR
-	a.MessageId  = append(s.gls.ID[:0],getarg(args,1)...)
-	a.Group      = getarg(args,2)
-	a.Number     = argtoi64(args,3)
-	a.HasId      = argtrue(args,4)
-	a.HasNum     = argtrue(args,5)
-	a.LastNumber = argtoi64(args,6)
+	a.MessageId  = append(s.gls.ID[:0],p.Bytes(1)...)
+	a.Group      = p.Bytes(2)
+	a.Number     = p.Int(3)
+	a.HasId      = p.Bool(4)
+	a.HasNum     = p.Bool(5)
+	a.LastNumber = p.Int(6)
+	if p.Err!=nil { return s.syntax(p.Err) }
 	if s.rh.ArticleCaps!=nil {
 		f := s.rh.WriteOverview(a)
 		if f!=nil { f(s) }
@@ -96,7 +102,8 @@ func (c *Client) StatArticle(a *fastnntp.Article) bool {
 	
 	L.resp()
 	
-	args,_ := c.b.readSplit()
+	args,err := c.reply()
+	if err!=nil { return false }
 	ok := argtrue(args,0)
 	if !a.HasId {
 		a.MessageId = append(a.MessageId,getarg(args,1)...)
@@ -107,11 +114,12 @@ func (c *Client) StatArticle(a *fastnntp.Article) bool {
 func (c *Client) GetArticleInto(a *fastnntp.Article, head, body bool, targ io.Writer) bool {
 	L := c.req(); defer L.release()
 	
-	c.b.writeSplit("GET",a.MessageId,a.Group,a.Number,a.HasId,a.HasNum)
+	c.b.writeSplit("GET",a.MessageId,a.Group,a.Number,a.HasId,a.HasNum,head,body)
 	
 	L.resp()
 	
-	args,_ := c.b.readSplit()
+	args,err := c.reply()
+	if err!=nil { return false }
 	ok := argtrue(args,0)
 	if !a.HasId {
 		a.MessageId = append(a.MessageId,getarg(args,1)...)
@@ -143,7 +151,7 @@ func (c *Client) WriteOverviewInto(a *fastnntp.ArticleRange, w fastnntp.IOvervie
 	L.resp()
 	
 	for {
-		args,err := c.b.readSplit()
+		args,err := c.reply()
 		if err!=nil { return }
 		if !argtrue(args,0) { break }
 		
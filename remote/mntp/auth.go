@@ -0,0 +1,306 @@
+/*
+Copyright (c) 2021 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package mntpc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"github.com/byte-mug/fastnntp"
+	"github.com/maxymania/fastnntp-polyglot/postauth"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"time"
+)
+
+/*
+Authentication:
+
+	AUTH method name proof time  ->  1 rank
+
+Methods:
+
+	token  proof is the shared secret of 'name'.
+	hmac   proof is hex(HMAC-SHA256(secret, name TAB time TAB nonce)), time in
+	       unix seconds, nonce from the HELLO reply. Requires version >= 3, so
+	       that a proof can't be replayed on another connection.
+	cert   the name is taken from the verified client certificate (mutual TLS).
+
+A failed authentication is answered with the error reply "auth-failed".
+If the server requires authentication, all commands but HELLO and AUTH are
+answered with "auth-required" until the client authenticated.
+*/
+
+const (
+	ErrCodeAuthRequired = "auth-required"
+	ErrCodeAuthFailed   = "auth-failed"
+)
+
+var ErrUnsupported = errors.New("mntp: command not supported by the server")
+
+// The authenticated peer of a connection.
+type Peer struct {
+	Name string
+	Rank postauth.AuthRank
+	
+	// The TLS connection state, if the connection uses TLS.
+	TLS *tls.ConnectionState
+}
+
+type AuthRequest struct {
+	Method, Name string
+	Proof        []byte
+	Time         int64
+	TLS          *tls.ConnectionState
+	
+	// The nonce of the connection (see HELLO). Empty, if none was sent.
+	Nonce        string
+}
+
+type Authenticator interface {
+	// Returns the authenticated peer or nil.
+	Authenticate(req *AuthRequest) *Peer
+}
+
+type Credential struct {
+	Secret []byte
+	Rank   postauth.AuthRank
+}
+
+/*
+Authenticates peers by shared secrets ("token" and "hmac") or by the
+CommonName of their client certificate ("cert").
+*/
+type SharedSecrets struct {
+	Users map[string]Credential
+	
+	// Ranks of client certificates, by the CommonName of their subject.
+	Certs map[string]postauth.AuthRank
+	
+	// Maximum clock skew for the "hmac" method. Defaults to 5 minutes.
+	MaxSkew time.Duration
+}
+
+func hmacProof(secret []byte, name string, t int64, nonce string) []byte {
+	m := hmac.New(sha256.New,secret)
+	io.WriteString(m,name+"\t"+strconv.FormatInt(t,10)+"\t"+nonce)
+	return []byte(hex.EncodeToString(m.Sum(nil)))
+}
+
+func (s *SharedSecrets) Authenticate(req *AuthRequest) *Peer {
+	switch req.Method {
+	case "token","hmac":
+		cred,ok := s.Users[req.Name]
+		if !ok || len(cred.Secret)==0 { return nil }
+		if req.Method=="token" {
+			if subtle.ConstantTimeCompare(cred.Secret,req.Proof)!=1 { return nil }
+		} else {
+			if req.Nonce=="" { return nil }
+			skew := s.MaxSkew
+			if skew<=0 { skew = 5*time.Minute }
+			d := time.Since(time.Unix(req.Time,0))
+			if d<0 { d = -d }
+			if d>skew { return nil }
+			if !hmac.Equal(hmacProof(cred.Secret,req.Name,req.Time,req.Nonce),req.Proof) { return nil }
+		}
+		return &Peer{Name:req.Name,Rank:cred.Rank,TLS:req.TLS}
+	case "cert":
+		if req.TLS==nil || len(req.TLS.VerifiedChains)==0 { return nil }
+		cn := req.TLS.VerifiedChains[0][0].Subject.CommonName
+		rank,ok := s.Certs[cn]
+		if !ok { return nil }
+		return &Peer{Name:cn,Rank:rank,TLS:req.TLS}
+	}
+	return nil
+}
+
+// Derives a handler for an authenticated rank, eg. advauthif.Deriver.
+type RankDeriver interface {
+	DeriveRank(h *fastnntp.Handler, r postauth.AuthRank) *fastnntp.Handler
+}
+
+// Optional interface of a RankDeriver, that also gets the identity of the peer.
+type PeerDeriver interface {
+	DerivePeer(h *fastnntp.Handler, p *Peer) *fastnntp.Handler
+}
+
+type ServerConfig struct {
+	Handler fastnntp.Handler
+	
+	// If not nil, connections are wrapped into TLS. Set ClientAuth to
+	// tls.RequireAndVerifyClientCert for mutual TLS.
+	TLS *tls.Config
+	
+	// If not nil, clients must authenticate.
+	Auth Authenticator
+	
+	// If not nil, the Handler is derived for every authenticated peer.
+	Derive RankDeriver
+	
+	// If > 0, connections, that are idle for longer, are closed. Clients
+	// should send heartbeats (Client.StartHeartbeat) more often.
+	// Requires a net.Conn.
+	IdleTimeout time.Duration
+}
+
+/*
+Serves a connection using the configuration. ServeConn(conn,h) is equivalent
+to (&ServerConfig{Handler:h}).ServeConn(conn).
+*/
+func (cfg *ServerConfig) ServeConn(conn io.ReadWriteCloser) {
+	if cfg.TLS!=nil {
+		nc,ok := conn.(net.Conn)
+		if !ok { conn.Close(); return }
+		tc := tls.Server(nc,cfg.TLS)
+		if tc.Handshake()!=nil { tc.Close(); return }
+		conn = tc
+	}
+	s := new(server)
+	s.b = wrapiob(conn)
+	s.rh = cfg.Handler
+	s.cfg = cfg
+	if tc,ok := conn.(*tls.Conn); ok {
+		st := tc.ConnectionState()
+		s.tls = &st
+	}
+	s.serve()
+}
+
+func (s *server) authRequired(cmd string) bool {
+	if s.cfg==nil || s.cfg.Auth==nil || s.peer!=nil { return false }
+	return cmd!="HELLO" && cmd!="AUTH"
+}
+
+func handleAUTH(s *server,args [][]byte) error {
+	p := Args{F:args}
+	req := &AuthRequest{
+		Method: string(p.Bytes(1)),
+		Name:   string(p.Bytes(2)),
+		Proof:  p.Bytes(3),
+		Time:   p.Int(4),
+		TLS:    s.tls,
+		Nonce:  s.nonce,
+	}
+	if p.Err!=nil { return s.syntax(p.Err) }
+	// Without an Authenticator, every client has full access.
+	if s.cfg==nil || s.cfg.Auth==nil { return s.b.writeSplit(true,int64(postauth.ARFeeder)) }
+	peer := s.cfg.Auth.Authenticate(req)
+	if peer==nil { return s.writeError(ErrCodeAuthFailed,req.Method) }
+	s.peer = peer
+	s.rh = s.cfg.Handler
+	if pd,ok := s.cfg.Derive.(PeerDeriver); ok {
+		s.rh = *pd.DerivePeer(&s.rh,peer)
+	} else if s.cfg.Derive!=nil {
+		s.rh = *s.cfg.Derive.DeriveRank(&s.rh,peer.Rank)
+	}
+	return s.b.writeSplit(true,int64(peer.Rank))
+}
+
+/*
+Authenticates the client. Method is "token", "hmac" or "cert".
+*/
+func (c *Client) Auth(method, name string, secret []byte) (postauth.AuthRank,error) {
+	if !c.Supports("AUTH") { return 0,ErrUnsupported }
+	L := c.req(); defer L.release()
+	
+	t := time.Now().Unix()
+	var proof []byte
+	switch method {
+	case "token": proof = secret
+	case "hmac":
+		if c.f.nonce=="" { return 0,ErrUnsupported }
+		proof = hmacProof(secret,name,t,c.f.nonce)
+	}
+	if err := c.b.writeSplit("AUTH",method,name,proof,t); err!=nil { return 0,err }
+	
+	L.resp()
+	
+	args,err := c.b.readReply()
+	if err!=nil { return 0,err }
+	if err := replyError(args); err!=nil { return 0,err }
+	if !argtrue(args,0) { return 0,errShortReply }
+	return postauth.AuthRank(argtoi64(args,1)),nil
+}
+
+/*
+Dials a TLS connection and returns a Client.
+*/
+func DialTLS(network, addr string, cfg *tls.Config) (*Client,error) {
+	conn,err := tls.Dial(network,addr,cfg)
+	if err!=nil { return nil,err }
+	return NewClient(conn),nil
+}
+
+func loadPool(caFile string) (*x509.CertPool,error) {
+	pem,err := ioutil.ReadFile(caFile)
+	if err!=nil { return nil,err }
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) { return nil,errors.New("mntp: no certificates in "+caFile) }
+	return pool,nil
+}
+
+/*
+Creates a server side TLS configuration. If clientCA is not empty, clients
+must present a certificate signed by it (mutual TLS).
+*/
+func ServerTLSConfig(certFile, keyFile, clientCA string) (*tls.Config,error) {
+	cert,err := tls.LoadX509KeyPair(certFile,keyFile)
+	if err!=nil { return nil,err }
+	cfg := &tls.Config{Certificates:[]tls.Certificate{cert},MinVersion:tls.VersionTLS12}
+	if clientCA!="" {
+		cfg.ClientCAs,err = loadPool(clientCA)
+		if err!=nil { return nil,err }
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg,nil
+}
+
+/*
+Creates a client side TLS configuration. certFile and keyFile are optional
+(mutual TLS), caFile is optional (system roots otherwise).
+*/
+func ClientTLSConfig(certFile, keyFile, caFile, serverName string) (*tls.Config,error) {
+	cfg := &tls.Config{ServerName:serverName,MinVersion:tls.VersionTLS12}
+	if certFile!="" {
+		cert,err := tls.LoadX509KeyPair(certFile,keyFile)
+		if err!=nil { return nil,err }
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if caFile!="" {
+		pool,err := loadPool(caFile)
+		if err!=nil { return nil,err }
+		cfg.RootCAs = pool
+	}
+	return cfg,nil
+}
+
+func init() {
+	mntpCommands["AUTH"] = handleAUTH
+}
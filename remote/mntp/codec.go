@@ -0,0 +1,186 @@
+/*
+Copyright (c) 2021 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package mntpc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+/*
+Line codec.
+
+An MNTP line consists of tab-separated fields, terminated by "\n" (or "\r\n").
+An empty line has no fields. Numbers are non-negative decimal integers,
+booleans are "0" or "1".
+
+The encoder never produces malformed lines: tabs, carriage returns, newlines
+and NUL bytes within a field are replaced by spaces (like in NNTP overviews),
+negative numbers are sent as 0.
+
+The decoder rejects lines with more than MaxFields fields and lines with
+control characters (CR, NUL) inside a field. The terminator is optional, as
+the line reader may strip it.
+*/
+
+const MaxFields = 64
+
+var ErrTooManyFields = errors.New("mntp: too many fields")
+
+type SyntaxError struct {
+	Field int
+	Msg   string
+}
+func (e *SyntaxError) Error() string { return fmt.Sprintf("mntp: field %d: %s",e.Field,e.Msg) }
+
+/*
+Splits a line into its fields, appending them to targ. The fields point
+into line.
+*/
+func DecodeLine(line []byte, targ [][]byte) ([][]byte,error) {
+	n := len(line)
+	if n>0 && line[n-1]=='\n' { n-- }
+	if n>0 && line[n-1]=='\r' { n-- }
+	if n==0 { return targ,nil }
+	j,k := 0,0
+	for i := 0; i<n; i++ {
+		switch line[i] {
+		case '\t':
+			if k++; k>=MaxFields { return targ,ErrTooManyFields }
+			targ = append(targ,line[j:i])
+			j = i+1
+		case '\r','\n',0:
+			return targ,&SyntaxError{k,"control character"}
+		}
+	}
+	return append(targ,line[j:n]),nil
+}
+
+func appendField(targ []byte, f []byte) []byte {
+	for _,b := range f {
+		switch b {
+		case '\t','\r','\n',0: b = ' '
+		}
+		targ = append(targ,b)
+	}
+	return targ
+}
+
+/*
+Encodes the fields into a line and appends it to targ. Supported types are
+[]byte, string, bool, int64 and int.
+*/
+func AppendLine(targ []byte, elems... interface{}) []byte {
+	for i,e := range elems {
+		if i!=0 { targ = append(targ,'\t') }
+		switch v := e.(type) {
+		case []byte: targ = appendField(targ,v)
+		case string: targ = appendField(targ,[]byte(v))
+		case bool: targ = append(targ,strmap_bool[v])
+		case int64: if v<0 { v = 0 }; targ = strconv.AppendInt(targ,v,10)
+		case int: if v<0 { v = 0 }; targ = strconv.AppendInt(targ,int64(v),10)
+		default: panic(fmt.Sprintf("mntp: can't encode %T",e))
+		}
+	}
+	return append(targ,'\n')
+}
+
+var strmap_bool = map[bool]byte {
+	false: '0',
+	true: '1',
+}
+
+// Parses a non-negative decimal number.
+func ParseInt(b []byte) (int64,error) {
+	if len(b)==0 { return 0,errors.New("empty number") }
+	for _,c := range b {
+		if c<'0' || c>'9' { return 0,errors.New("not a number") }
+	}
+	return strconv.ParseInt(string(b),10,64)
+}
+
+// Parses "0" or "1".
+func ParseBool(b []byte) (bool,error) {
+	if len(b)==1 {
+		switch b[0] {
+		case '0': return false,nil
+		case '1': return true,nil
+		}
+	}
+	return false,errors.New("not a boolean")
+}
+
+/*
+Strict accessor for the fields of a request. The first error is kept in
+Err; after an error, all accessors return zero values.
+*/
+type Args struct {
+	F   [][]byte
+	Err error
+}
+func (a *Args) fail(i int, msg string) {
+	if a.Err==nil { a.Err = &SyntaxError{i,msg} }
+}
+
+// Returns field i. The field must exist.
+func (a *Args) Bytes(i int) []byte {
+	if a.Err!=nil { return nil }
+	if i>=len(a.F) { a.fail(i,"missing"); return nil }
+	return a.F[i]
+}
+func (a *Args) Int(i int) int64 {
+	b := a.Bytes(i)
+	if a.Err!=nil { return 0 }
+	v,err := ParseInt(b)
+	if err!=nil { a.fail(i,err.Error()) }
+	return v
+}
+func (a *Args) Bool(i int) bool {
+	b := a.Bytes(i)
+	if a.Err!=nil { return false }
+	v,err := ParseBool(b)
+	if err!=nil { a.fail(i,err.Error()) }
+	return v
+}
+
+// Returns the fields from i on (possibly none).
+func (a *Args) Rest(i int) [][]byte {
+	if a.Err!=nil || i>=len(a.F) { return nil }
+	return a.F[i:]
+}
+
+// Lenient accessors for replies: missing or malformed fields are zero.
+
+func getarg(args [][]byte,i int) []byte {
+	if i<len(args) { return args[i] }
+	return nil
+}
+
+func argtrue(args [][]byte,i int) bool { return string(getarg(args,i))=="1" }
+
+func argtoi64(args [][]byte,j int) int64 {
+	i,_ := ParseInt(getarg(args,j))
+	return i
+}
@@ -0,0 +1,254 @@
+/*
+Copyright (c) 2021 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package mntpc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/byte-mug/fastnntp"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type fuzzConn struct {
+	io.Reader
+	io.Writer
+}
+func (fuzzConn) Close() error { return nil }
+
+func fields(args [][]byte) (r []interface{}) {
+	for _,a := range args { r = append(r,a) }
+	return
+}
+
+func TestDecodeLine(t *testing.T) {
+	max := strings.Repeat("\t",MaxFields-1)
+	for _,c := range []struct{
+		line string
+		want []string
+		err  error
+		fld  int
+	}{
+		{"",nil,nil,0},
+		{"\n",nil,nil,0},
+		{"\r\n",nil,nil,0},
+		{"a",[]string{"a"},nil,0},
+		{"a\tb\r\n",[]string{"a","b"},nil,0},
+		{"a\t\tb\n",[]string{"a","","b"},nil,0},
+		{"\t\n",[]string{"",""},nil,0},
+		{max+"\n",make([]string,MaxFields),nil,0},
+		{max+"\t\n",nil,ErrTooManyFields,0},
+		{"a\rb\n",nil,new(SyntaxError),0},
+		{"a\tb\x00\n",nil,new(SyntaxError),1},
+		{"a\n\n",nil,new(SyntaxError),0},
+		{"a\r\r\n",nil,new(SyntaxError),0},
+	} {
+		args,err := DecodeLine([]byte(c.line),nil)
+		switch e := err.(type) {
+		case nil:
+			if c.err!=nil { t.Errorf("%q: no error, want %v",c.line,c.err); continue }
+		case *SyntaxError:
+			if _,ok := c.err.(*SyntaxError); !ok || e.Field!=c.fld { t.Errorf("%q: %v",c.line,err) }
+			continue
+		default:
+			if err!=c.err { t.Errorf("%q: %v, want %v",c.line,err,c.err) }
+			continue
+		}
+		if len(args)!=len(c.want) { t.Errorf("%q: %d fields, want %d",c.line,len(args),len(c.want)); continue }
+		for i := range args {
+			if string(args[i])!=c.want[i] { t.Errorf("%q: field %d = %q, want %q",c.line,i,args[i],c.want[i]) }
+		}
+	}
+}
+
+func TestParseInt(t *testing.T) {
+	for _,c := range []struct{
+		s  string
+		v  int64
+		ok bool
+	}{
+		{"0",0,true},
+		{"007",7,true},
+		{"9223372036854775807",9223372036854775807,true},
+		{"9223372036854775808",0,false},
+		{"99999999999999999999",0,false},
+		{"",0,false},
+		{"-1",0,false},
+		{"+1",0,false},
+		{" 1",0,false},
+		{"1a",0,false},
+	} {
+		v,err := ParseInt([]byte(c.s))
+		if (err==nil)!=c.ok || (c.ok && v!=c.v) { t.Errorf("ParseInt(%q) = %d,%v",c.s,v,err) }
+	}
+}
+
+func TestArgs(t *testing.T) {
+	bs := func(s... string) (r [][]byte) {
+		for _,e := range s { r = append(r,[]byte(e)) }
+		return
+	}
+	p := Args{F:bs("CMD","12","1","x","0")}
+	if p.Int(1)!=12 || !p.Bool(2) || string(p.Bytes(0))!="CMD" || p.Err!=nil { t.Fatalf("valid fields: %v",p.Err) }
+	if len(p.Rest(3))!=2 || p.Rest(5)!=nil { t.Fatal("Rest") }
+	
+	for _,c := range []struct{
+		name string
+		get  func(p *Args)
+		fld  int
+	}{
+		{"missing",func(p *Args) { p.Bytes(5) },5},
+		{"bad int",func(p *Args) { p.Int(3) },3},
+		{"bad bool",func(p *Args) { p.Bool(1) },1},
+		{"missing int",func(p *Args) { p.Int(7) },7},
+		{"first error kept",func(p *Args) { p.Int(3); p.Bool(1); p.Bytes(9) },3},
+	} {
+		p := Args{F:bs("CMD","12","1","x","0")}
+		c.get(&p)
+		var e *SyntaxError
+		if !errors.As(p.Err,&e) || e.Field!=c.fld { t.Errorf("%s: %v",c.name,p.Err); continue }
+		// After an error, every accessor yields the zero value.
+		if p.Int(1)!=0 || p.Bool(2) || p.Bytes(0)!=nil || p.Rest(0)!=nil { t.Errorf("%s: accessor after error",c.name) }
+		if p.Err.(*SyntaxError)!=e { t.Errorf("%s: error replaced",c.name) }
+	}
+}
+
+func FuzzDecodeLine(f *testing.F) {
+	for _,s := range []string{"","\n","STAT\t<a@b>\tg\t1\t1\t0\n","\t\t\r\n","a\rb\n","x\x00\n"} {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, line []byte) {
+		args,err := DecodeLine(line,nil)
+		if err!=nil { return }
+		if len(args)>MaxFields { t.Fatalf("%d fields",len(args)) }
+		enc := AppendLine(nil,fields(args)...)
+		again,err := DecodeLine(enc,nil)
+		if err!=nil { t.Fatalf("re-decoding %q: %v",enc,err) }
+		if len(again)!=len(args) { t.Fatalf("%q: %d fields, want %d",enc,len(again),len(args)) }
+		for i := range args {
+			if !bytes.Equal(args[i],again[i]) { t.Fatalf("field %d: %q != %q",i,again[i],args[i]) }
+		}
+	})
+}
+
+func FuzzParseInt(f *testing.F) {
+	for _,s := range []string{"0","123","-1","+1","9223372036854775808"," 1",""} { f.Add([]byte(s)) }
+	f.Fuzz(func(t *testing.T, b []byte) {
+		v,err := ParseInt(b)
+		if err!=nil { return }
+		if v<0 { t.Fatalf("%q: negative %d",b,v) }
+		if w,_ := strconv.ParseInt(string(b),10,64); w!=v { t.Fatalf("%q: %d != %d",b,v,w) }
+	})
+}
+
+/*
+A backend that panics on the group "panic", so that the recovery in serve()
+is part of the fuzzing.
+*/
+type fuzzGroups struct{}
+func (fuzzGroups) GetGroup(g *fastnntp.Group) bool {
+	if string(g.Group)=="panic" { panic("fuzz") }
+	g.Number,g.Low,g.High = 3,1,3
+	return true
+}
+func (fuzzGroups) ListGroup(g *fastnntp.Group, w *fastnntp.DotWriter, first, last int64) {
+	if string(g.Group)=="panic" { panic("fuzz") }
+	for i := first; i<=last && i<first+3; i++ { fmt.Fprintf(w,"%v\r\n",i) }
+}
+func (fuzzGroups) CursorMoveGroup(g *fastnntp.Group, i int64, backward bool, id_buf []byte) (ni int64, id []byte, ok bool) {
+	if string(g.Group)=="panic" { panic("fuzz") }
+	return i+1,append(id_buf,"<a@b>"...),true
+}
+
+/*
+Request grammar: every input must be handled without a crash. The requests
+are fed through a pipe into serve(), which runs until EOF (or until it
+closes the connection after a recovered panic).
+*/
+func FuzzServer(f *testing.F) {
+	for _,s := range []string{
+		"STAT\t<a@b>\tg\t1\t1\t0\n",
+		"GET\t\t\t\t\t\t\t\n",
+		"OVER\tx\n",
+		"POST\t<a@b>\r\nbody\r\n.\r\n",
+		"LISTGROUP\tg\t1\t1\t99999999999999999999\t0\t0\n",
+		"LISTGROUP\tg\t3\t1\t3\t1\t3\nGROUP\tg\n",
+		"GROUP\tpanic\nPING\n",
+		"POST\t<a@b>\tx\r\nbody\r\n.\r\nPING\n",
+		"MOVE\tg\t1\n",
+		"LIST\t1\n",
+		"HELLO\t2\tSTAT\n",
+		"AUTH\ttoken\n",
+		"PING\n",
+		"COMPRESS\tdeflate\n\x00\xff",
+		"\t\t\t\n\n",
+	} {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pr,pw := io.Pipe()
+		go func() {
+			pw.Write(data)
+			pw.Close()
+		}()
+		s := new(server)
+		s.rh = fastnntp.Handler{GroupCaps:fuzzGroups{}}
+		s.b = wrapiob(fuzzConn{pr,ioutil.Discard})
+		s.serve()
+		// serve() may stop reading early; unblock the writer.
+		pr.Close()
+	})
+}
+
+type fuzzList struct{}
+func (fuzzList) GetListActiveMode() fastnntp.ListActiveMode { return fastnntp.LAM_Full }
+func (fuzzList) WriteFullInfo(group []byte, high, low int64, status byte, description []byte) {}
+func (fuzzList) WriteActive(group []byte, high, low int64, status byte) {}
+func (fuzzList) WriteNewsgroups(group []byte, description []byte) {}
+
+type fuzzOverview struct{}
+func (fuzzOverview) WriteEntry(num int64, subject, from, date, msgId, refs []byte, lng, lines int64) error { return nil }
+
+// Response grammar: the Client must survive any reply.
+func FuzzClient(f *testing.F) {
+	f.Add([]byte("\n1\t<a@b>\n"))
+	f.Add([]byte("1\t2\tSTAT\tGET\tGROUP\tMOVE\tLIST\tOVER\tCHECK\n1\t<a@b>\n1\t5\t1\t5\n1\t2\t<c@d>\n1\tF\tg\t5\t1\ty\tdescr\n0\t1\n1\t1\ts\tf\td\t<a@b>\t\t10\t1\n0\n!\tsyntax\tx\n"))
+	f.Add([]byte("!\tunknown-command\tHELLO\n\t\t\t\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := NewClient(fuzzConn{bytes.NewReader(data),ioutil.Discard})
+		c.Version()
+		a := &fastnntp.Article{MessageId:[]byte("<a@b>"),HasId:true}
+		c.StatArticle(a)
+		c.GetGroup(&fastnntp.Group{Group:[]byte("g")})
+		c.CursorMoveGroup(&fastnntp.Group{Group:[]byte("g")},1,false,nil)
+		c.ListGroups(nil,fuzzList{})
+		c.WriteOverviewInto(&fastnntp.ArticleRange{Article:fastnntp.Article{Group:[]byte("g"),HasNum:true}},fuzzOverview{})
+		c.CheckPostId([]byte("<a@b>"))
+		c.GetArticleInto(a,true,true,ioutil.Discard)
+	})
+}
@@ -0,0 +1,179 @@
+/*
+Copyright (c) 2021 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package mntpc
+
+import (
+	"compress/flate"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Compression:
+
+	COMPRESS algorithm...  ->  1 algorithm
+
+The client offers a list of algorithms, the server picks the first one it
+supports (or answers 0). The reply is sent uncompressed; afterwards both
+directions are compressed. The client sends no further request, before it
+has read the reply, so no compressed data is read uncompressed.
+
+The compressed streams are flushed at the end of every request and response.
+Supported algorithms: "deflate".
+*/
+
+// Byte counters of a connection.
+type Stats struct {
+	// Uncompressed and on-the-wire bytes.
+	PlainIn, WireIn, PlainOut, WireOut int64
+}
+
+// Returns the ratio of uncompressed to on-the-wire bytes (both directions).
+func (s Stats) Ratio() float64 {
+	if s.WireIn+s.WireOut==0 { return 1 }
+	return float64(s.PlainIn+s.PlainOut)/float64(s.WireIn+s.WireOut)
+}
+
+type countReader struct {
+	r io.Reader
+	n *int64
+}
+func (c countReader) Read(p []byte) (n int, err error) {
+	n,err = c.r.Read(p)
+	atomic.AddInt64(c.n,int64(n))
+	return
+}
+type countWriter struct {
+	w io.Writer
+	n *int64
+}
+func (c countWriter) Write(p []byte) (n int, err error) {
+	n,err = c.w.Write(p)
+	atomic.AddInt64(c.n,int64(n))
+	return
+}
+
+/*
+The connection of an iobuffer. Transparently compresses, once start() has
+been called.
+*/
+type compConn struct {
+	raw io.ReadWriteCloser
+	r   io.Reader
+	zw  *flate.Writer
+	st  Stats
+	
+	// Time of the last data received, including dot-encoded bodies
+	// (unix nanoseconds).
+	last int64
+}
+func (c *compConn) Read(p []byte) (n int, err error) {
+	if c.r==nil {
+		n,err = c.raw.Read(p)
+		atomic.AddInt64(&c.st.WireIn,int64(n))
+	} else {
+		n,err = c.r.Read(p)
+	}
+	atomic.AddInt64(&c.st.PlainIn,int64(n))
+	if n>0 { atomic.StoreInt64(&c.last,time.Now().UnixNano()) }
+	return
+}
+func (c *compConn) Write(p []byte) (n int, err error) {
+	if c.zw==nil {
+		n,err = c.raw.Write(p)
+		atomic.AddInt64(&c.st.WireOut,int64(n))
+	} else {
+		n,err = c.zw.Write(p)
+	}
+	atomic.AddInt64(&c.st.PlainOut,int64(n))
+	return
+}
+func (c *compConn) Close() error { return c.raw.Close() }
+func (c *compConn) flush() error {
+	if c.zw==nil { return nil }
+	return c.zw.Flush()
+}
+func (c *compConn) start(algo string) bool {
+	if algo!="deflate" { return false }
+	c.r = flate.NewReader(countReader{c.raw,&c.st.WireIn})
+	c.zw,_ = flate.NewWriter(countWriter{c.raw,&c.st.WireOut},flate.DefaultCompression)
+	return true
+}
+func (c *compConn) stats() Stats {
+	return Stats{
+		PlainIn:  atomic.LoadInt64(&c.st.PlainIn),
+		WireIn:   atomic.LoadInt64(&c.st.WireIn),
+		PlainOut: atomic.LoadInt64(&c.st.PlainOut),
+		WireOut:  atomic.LoadInt64(&c.st.WireOut),
+	}
+}
+
+// Flushes the compressed stream at the end of a request or response.
+func (i *iobuffer) flush() error {
+	if err := i.geterr(); err!=nil { return err }
+	return i.seterr(i.c.flush())
+}
+
+func handleCOMPRESS(s *server,args [][]byte) error {
+	if s.b.c.zw!=nil { return s.b.writeSplit(false,"") } // Already compressed.
+	for _,a := range args[1:] {
+		switch string(a) {
+		case "deflate":
+			if err := s.b.writeSplit(true,a); err!=nil { return err }
+			s.b.c.start(string(a))
+			return nil
+		}
+	}
+	return s.b.writeSplit(false,"")
+}
+
+/*
+Enables compression on the connection. Should be called right after
+connecting (eg. in PoolConfig.Setup); requests issued concurrently wait for it.
+*/
+func (c *Client) Compress() error {
+	if !c.Supports("COMPRESS") { return ErrUnsupported }
+	if c.b.c.zw!=nil { return nil }
+	id := c.p.Next()
+	c.p.StartRequest(id)
+	err := c.b.writeSplit("COMPRESS","deflate")
+	
+	// Hold back further requests until the reply has been read.
+	c.p.StartResponse(id)
+	var args [][]byte
+	if err==nil { args,err = c.b.readReply() }
+	if err==nil { err = replyError(args) }
+	if err==nil && !(argtrue(args,0) && c.b.c.start(string(getarg(args,1)))) { err = ErrUnsupported }
+	c.p.EndRequest(id)
+	c.p.EndResponse(id)
+	return err
+}
+
+// Returns the byte counters of the connection.
+func (c *Client) Stats() Stats { return c.b.c.stats() }
+
+func init() {
+	mntpCommands["COMPRESS"] = handleCOMPRESS
+}
@@ -0,0 +1,198 @@
+/*
+Copyright (c) 2021 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package mntpc
+
+import "io"
+import "github.com/byte-mug/fastnntp"
+
+/*
+Group commands:
+
+	GROUP     group                                 -> ok number low high
+	LISTGROUP group number low high first last      -> ok [dot-encoded article numbers]
+	MOVE      group i backward                      -> ok ni id
+	LIST      mode                                  -> {1 kind group high low status descr} 0 ok
+
+These commands require protocol version 2. Against older servers, the
+Client reports "not found".
+
+LISTGROUP sends the article numbers, only if ok is true, so that an error
+reply is never mistaken for a list.
+
+The kind of a LIST entry is "F" (WriteFullInfo), "A" (WriteActive) or "N"
+(WriteNewsgroups). The WildMat of ListGroups is not transmitted.
+*/
+
+func handleGROUP(s *server,args [][]byte) error {
+	p := Args{F:args}
+	g := &s.gls.G
+	*g = fastnntp.Group{Group:p.Bytes(1)}
+	if p.Err!=nil { return s.syntax(p.Err) }
+	ok := s.rh.GroupCaps!=nil && s.rh.GetGroup(g)
+	return s.b.writeSplit(ok,g.Number,g.Low,g.High)
+}
+
+func handleLISTGROUP(s *server,args [][]byte) error {
+	p := Args{F:args}
+	g := &s.gls.G
+	*g = fastnntp.Group{Group:p.Bytes(1)}
+	g.Number = p.Int(2)
+	g.Low    = p.Int(3)
+	g.High   = p.Int(4)
+	first   := p.Int(5)
+	last    := p.Int(6)
+	if p.Err!=nil { return s.syntax(p.Err) }
+	if s.rh.GroupCaps==nil { return s.b.writeSplit(false) }
+	err := s.b.writeSplit(true)
+	w := s.b.writeDot()
+	s.rh.ListGroup(g,w,first,last)
+	err2 := w.Close()
+	w.Release()
+	return errsel(err,err2)
+}
+
+func handleMOVE(s *server,args [][]byte) error {
+	p := Args{F:args}
+	g := &s.gls.G
+	*g = fastnntp.Group{Group:p.Bytes(1)}
+	i,backward := p.Int(2),p.Bool(3)
+	if p.Err!=nil { return s.syntax(p.Err) }
+	var ni int64
+	var id []byte
+	var ok bool
+	if s.rh.GroupCaps!=nil {
+		ni,id,ok = s.rh.CursorMoveGroup(g,i,backward,s.gls.ID[:0])
+	}
+	return s.b.writeSplit(ok,ni,id)
+}
+
+type listWriter struct {
+	s    *server
+	mode fastnntp.ListActiveMode
+	err  error
+}
+func (l *listWriter) GetListActiveMode() fastnntp.ListActiveMode { return l.mode }
+func (l *listWriter) WriteFullInfo(group []byte, high, low int64, status byte, description []byte) {
+	if l.err!=nil { return }
+	l.err = l.s.b.writeSplit(true,"F",group,high,low,[]byte{status},description)
+}
+func (l *listWriter) WriteActive(group []byte, high, low int64, status byte) {
+	if l.err!=nil { return }
+	l.err = l.s.b.writeSplit(true,"A",group,high,low,[]byte{status},"")
+}
+func (l *listWriter) WriteNewsgroups(group []byte, description []byte) {
+	if l.err!=nil { return }
+	l.err = l.s.b.writeSplit(true,"N",group,int64(0),int64(0),"",description)
+}
+
+func handleLIST(s *server,args [][]byte) error {
+	p := Args{F:args}
+	l := &listWriter{s:s,mode:fastnntp.ListActiveMode(p.Int(1))}
+	if p.Err!=nil { return s.syntax(p.Err) }
+	ok := s.rh.GroupListingCaps!=nil && s.rh.ListGroups(nil,l)
+	return errsel(l.err,s.b.writeSplit(false,ok))
+}
+
+func (c *Client) GetGroup(g *fastnntp.Group) bool {
+	if !c.Supports("GROUP") { return false }
+	L := c.req(); defer L.release()
+	
+	c.b.writeSplit("GROUP",g.Group)
+	
+	L.resp()
+	
+	args,err := c.reply()
+	if err!=nil { return false }
+	ok := argtrue(args,0)
+	if ok {
+		g.Number = argtoi64(args,1)
+		g.Low    = argtoi64(args,2)
+		g.High   = argtoi64(args,3)
+	}
+	return ok
+}
+func (c *Client) ListGroup(g *fastnntp.Group, w *fastnntp.DotWriter, first, last int64) {
+	if !c.Supports("LISTGROUP") { return }
+	L := c.req(); defer L.release()
+	
+	c.b.writeSplit("LISTGROUP",g.Group,g.Number,g.Low,g.High,first,last)
+	
+	L.resp()
+	
+	args,err := c.reply()
+	if err!=nil || !argtrue(args,0) { return }
+	r := c.b.readDot()
+	defer ConsumeRelease(r)
+	io.Copy(w,r)
+}
+func (c *Client) CursorMoveGroup(g *fastnntp.Group, i int64, backward bool, id_buf []byte) (ni int64, id []byte, ok bool) {
+	if !c.Supports("MOVE") { return }
+	L := c.req(); defer L.release()
+	
+	c.b.writeSplit("MOVE",g.Group,i,backward)
+	
+	L.resp()
+	
+	args,err := c.reply()
+	if err!=nil { return }
+	ok = argtrue(args,0)
+	if ok {
+		ni = argtoi64(args,1)
+		id = append(id_buf,getarg(args,2)...)
+	}
+	return
+}
+func (c *Client) ListGroups(wm *fastnntp.WildMat, ila fastnntp.IListActive) bool {
+	if !c.Supports("LIST") { return false }
+	L := c.req(); defer L.release()
+	
+	c.b.writeSplit("LIST",int64(ila.GetListActiveMode()))
+	
+	L.resp()
+	
+	for {
+		args,err := c.reply()
+		if err!=nil { return false }
+		if !argtrue(args,0) { return argtrue(args,1) }
+		
+		group  := getarg(args,2)
+		high   := argtoi64(args,3)
+		low    := argtoi64(args,4)
+		var status byte
+		if st := getarg(args,5); len(st)>0 { status = st[0] }
+		descr  := getarg(args,6)
+		switch string(getarg(args,1)) {
+		case "F": ila.WriteFullInfo(group,high,low,status,descr)
+		case "A": ila.WriteActive(group,high,low,status)
+		case "N": ila.WriteNewsgroups(group,descr)
+		}
+	}
+}
+
+func init() {
+	mntpCommands["GROUP"]     = handleGROUP
+	mntpCommands["LISTGROUP"] = handleLISTGROUP
+	mntpCommands["MOVE"]      = handleMOVE
+	mntpCommands["LIST"]      = handleLIST
+}
@@ -0,0 +1,185 @@
+/*
+Copyright (c) 2021 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package mntpc
+
+import "crypto/rand"
+import "encoding/hex"
+import "sort"
+import "strconv"
+import "sync"
+
+/*
+Protocol versions:
+
+	1: STAT GET OVER CHECK POST (no handshake).
+	2: HELLO, error replies, GROUP LISTGROUP MOVE LIST, AUTH, COMPRESS, PING.
+	3: HELLO reply carries a nonce for AUTH hmac.
+*/
+const ProtocolVersion = 3
+
+var baseCommands = []string{"STAT","GET","OVER","CHECK","POST"}
+
+/*
+Handshake:
+
+	HELLO version command...  ->  1 version command...
+	HELLO version command...  ->  1 version nonce command...  (both >= 3)
+
+The client sends its protocol version and the commands it uses, the server
+responds with its version and the commands it supports. A server of version
+1 answers HELLO (like any unknown command) with an empty line. If both sides
+are of version >= 3, the server adds a random nonce, that is bound to the
+connection (see AUTH).
+
+A server of version >= 2 answers unknown commands with an error reply:
+
+	! code text
+*/
+
+// Error codes of error replies.
+const (
+	ErrCodeUnknown = "unknown-command"
+	ErrCodeSyntax  = "syntax"
+	ErrCodeInternal = "internal"
+)
+
+// An error reply of the server.
+type ServerError struct {
+	Code, Text string
+}
+func (e *ServerError) Error() string { return "mntp: "+e.Code+": "+e.Text }
+
+func replyError(args [][]byte) error {
+	if string(getarg(args,0))!="!" { return nil }
+	return &ServerError{string(getarg(args,1)),string(getarg(args,2))}
+}
+
+/*
+Reads the reply to a request. An error reply is returned as *ServerError and
+breaks the Client (see Err): the request has not been served, and the rest
+of the reply (eg. a dot-encoded block) is missing.
+*/
+func (c *Client) reply() ([][]byte,error) {
+	args,err := c.b.readReply()
+	if err!=nil { return nil,err }
+	return args,c.b.seterr(replyError(args))
+}
+
+func (s *server) writeError(code, text string) error {
+	return s.b.writeSplit("!",code,text)
+}
+func (s *server) syntax(err error) error {
+	return s.writeError(ErrCodeSyntax,err.Error())
+}
+
+func commandList() (l []string) {
+	for k := range mntpCommands { l = append(l,k) }
+	sort.Strings(l)
+	return
+}
+
+func handleHELLO(s *server,args [][]byte) error {
+	p := Args{F:args}
+	s.peerVersion = int(p.Int(1))
+	if p.Err!=nil { return s.syntax(p.Err) }
+	reply := []interface{}{true,int64(ProtocolVersion)}
+	if s.peerVersion>=3 {
+		var buf [16]byte
+		if _,err := rand.Read(buf[:]); err!=nil { return s.writeError(ErrCodeInternal,"nonce") }
+		s.nonce = hex.EncodeToString(buf[:])
+		reply = append(reply,s.nonce)
+	}
+	for _,c := range commandList() { reply = append(reply,c) }
+	return s.b.writeSplit(reply...)
+}
+
+type features struct {
+	once    sync.Once
+	err     error
+	version int
+	nonce   string
+	cmds    map[string]bool
+}
+
+/*
+Performs the handshake, if not done yet. Returns an error, if the
+connection failed.
+
+The handshake is performed automatically, when needed.
+*/
+func (c *Client) Hello() error {
+	c.f.once.Do(c.hello)
+	return c.f.err
+}
+func (c *Client) hello() {
+	L := c.req(); defer L.release()
+	
+	req := []interface{}{"HELLO",int64(ProtocolVersion)}
+	for _,cmd := range commandList() { req = append(req,cmd) }
+	if err := c.b.writeSplit(req...); err!=nil { c.f.err = err; return }
+	
+	L.resp()
+	
+	args,err := c.b.readReply()
+	if err!=nil { c.f.err = err; return }
+	c.f.cmds = make(map[string]bool)
+	if !argtrue(args,0) {
+		// Version 1 server.
+		c.f.version = 1
+		for _,cmd := range baseCommands { c.f.cmds[cmd] = true }
+		return
+	}
+	c.f.version,_ = strconv.Atoi(string(getarg(args,1)))
+	if len(args)<2 { return }
+	args = args[2:]
+	if c.f.version>=3 && len(args)>0 {
+		c.f.nonce = string(args[0])
+		args = args[1:]
+	}
+	for _,cmd := range args { c.f.cmds[string(cmd)] = true }
+}
+
+// Returns the protocol version of the server, or 0 if the handshake failed.
+func (c *Client) Version() int {
+	if c.Hello()!=nil { return 0 }
+	return c.f.version
+}
+
+// Reports, whether the server supports the command.
+func (c *Client) Supports(cmd string) bool {
+	if c.Hello()!=nil { return false }
+	return c.f.cmds[cmd]
+}
+
+// Returns the commands supported by the server.
+func (c *Client) Commands() (l []string) {
+	if c.Hello()!=nil { return }
+	for k := range c.f.cmds { l = append(l,k) }
+	sort.Strings(l)
+	return
+}
+
+func init() {
+	mntpCommands["HELLO"] = handleHELLO
+}
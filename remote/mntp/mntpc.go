@@ -33,6 +33,9 @@ import (
 	"github.com/byte-mug/fastnntp"
 	"sync"
 	"fmt"
+	"crypto/tls"
+	"errors"
+	"time"
 )
 
 func errsel(errs ...error) error {
@@ -40,61 +43,17 @@ func errsel(errs ...error) error {
 	return nil
 }
 
-var strmap_bool = map[bool]byte {
-	false: '0',
-	true: '1',
-}
-
-func lsplit(line []byte,targ [][]byte) [][]byte {
-	i,j,n := 0,0,len(line)
-	for i<n {
-		switch line[i] {
-		case '\r','\n':
-			targ = append(targ,line[j:i])
-			return targ
-		case '\t':
-			targ = append(targ,line[j:i])
-			j = i+1
-		}
-		i++
-	}
-	return targ
-}
-func ljoin(targ []byte, elems... interface{}) []byte {
-	for i,e := range elems {
-		if i!=0 { targ = append(targ,'\t') }
-		switch v := e.(type) {
-		case []byte: targ = append(targ,v...)
-		case string: targ = append(targ,v...)
-		case bool: targ = append(targ,strmap_bool[v])
-		case int64: if v<0 { v = 0 }; targ = append(targ,fmt.Sprint(v)...)
-		}
-	}
-	return append(targ,'\n')
-}
-
-func getarg(args [][]byte,i int) []byte {
-	if len(args)<=i { return args[i] }
-	return nil
-}
-
-func argtrue(args [][]byte,i int) bool { return string(getarg(args,i))=="1" }
-
-func argtoi64(args [][]byte,j int) (i int64) {
-	a := getarg(args,j)
-	for _,b := range a {
-		i = (i*10)+int64(b-'0')
-	}
-	return
-}
-
 type iobuffer struct {
-	c io.ReadWriteCloser
+	c *compConn
 	r *fastnntp.Reader
 	
 	lineBuffer  []byte
 	outBuffer   []byte
 	splitbuf    [][]byte
+	
+	// The first I/O error. Once set, all reads and writes fail.
+	emu sync.Mutex
+	err error
 }
 var pool_iobuffer = sync.Pool{ New: func() interface{} {
 	return &iobuffer{
@@ -110,26 +69,52 @@ func (i *iobuffer) free() {
 	i.r.Release()
 	i.c = nil
 	i.r = nil
+	i.err = nil
 	pool_iobuffer.Put(i)
 }
 func wrapiob(c io.ReadWriteCloser) (i *iobuffer) {
 	i = pool_iobuffer.Get().(*iobuffer)
-	i.c = c
-	i.r = fastnntp.AcquireReader().Init(c)
+	i.c = &compConn{raw:c,last:time.Now().UnixNano()}
+	i.r = fastnntp.AcquireReader().Init(i.c)
 	return i
 }
 
+func (i *iobuffer) seterr(err error) error {
+	if err==nil { return nil }
+	i.emu.Lock(); defer i.emu.Unlock()
+	if i.err==nil { i.err = err }
+	return err
+}
+func (i *iobuffer) geterr() error {
+	i.emu.Lock(); defer i.emu.Unlock()
+	return i.err
+}
+
 func (i *iobuffer) readLine() ([]byte,error) {
 	if i==nil { return nil,io.EOF }
-	return i.r.ReadLineB(i.lineBuffer)
+	if err := i.geterr(); err!=nil { return nil,err }
+	line,err := i.r.ReadLineB(i.lineBuffer)
+	return line,i.seterr(err)
 }
+/*
+Reads and decodes a line. I/O errors are sticky (see geterr), syntax errors
+are not.
+*/
 func (i *iobuffer) readSplit() ([][]byte,error) {
 	line,err := i.readLine()
-	return lsplit(line,i.splitbuf),err
+	if err!=nil { return nil,err }
+	return DecodeLine(line,i.splitbuf[:0])
+}
+
+// Reads a reply. A malformed reply breaks the connection, as the stream is out of sync.
+func (i *iobuffer) readReply() ([][]byte,error) {
+	args,err := i.readSplit()
+	return args,i.seterr(err)
 }
 func (i *iobuffer) writeSplit(args... interface{}) error {
-	_,err := i.c.Write(ljoin(i.outBuffer,args...))
-	return err
+	if err := i.geterr(); err!=nil { return err }
+	_,err := i.c.Write(AppendLine(i.outBuffer,args...))
+	return i.seterr(err)
 }
 func (i *iobuffer) readDot() (r *fastnntp.DotReader) {
 	r = i.r.DotReader()
@@ -147,12 +132,20 @@ func ConsumeRelease(r *fastnntp.DotReader) {
 }
 
 type Client struct {
+	// If > 0, a request, that takes longer, breaks the connection. The time
+	// spent waiting for the responses of earlier (pipelined) requests is not
+	// counted. Set it before issuing requests.
+	Timeout time.Duration
+	
 	p pipeline.Pipeline
 	b *iobuffer
+	f features
 }
 type lock struct {
 	c *Client
 	id,state uint
+	d time.Duration
+	t *time.Timer
 }
 func (l *lock) upd(state uint) {
 	if state>2 { state = 2 }
@@ -160,9 +153,16 @@ func (l *lock) upd(state uint) {
 		l.state++
 		switch l.state {
 		case 1:
+			l.c.b.flush()
 			l.c.p.EndRequest(l.id)
+			
+			// Waiting for the responses of earlier requests is covered by
+			// their timers; the own timer restarts, once it's our turn.
+			if l.t!=nil { l.t.Stop() }
 			l.c.p.StartResponse(l.id)
+			if l.d>0 { l.t = time.AfterFunc(l.d,l.c.expire) }
 		case 2:
+			if l.t!=nil { l.t.Stop() }
 			l.c.p.EndResponse(l.id)
 		}
 	}
@@ -170,9 +170,25 @@ func (l *lock) upd(state uint) {
 func (l *lock) resp() { l.upd(1) }
 func (l *lock) release() { l.upd(2) }
 func (c *Client) req() *lock {
+	return c.reqTimeout(c.Timeout)
+}
+func (c *Client) reqTimeout(d time.Duration) *lock {
 	id := c.p.Next()
 	c.p.StartRequest(id)
-	return &lock{c,id,0}
+	l := &lock{c:c,id:id,d:d}
+	if d>0 { l.t = time.AfterFunc(d,c.expire) }
+	return l
+}
+
+var ErrTimeout = errors.New("mntp: request timed out")
+
+/*
+Breaks the connection. Closing the connection unblocks the request in
+progress; all pipelined requests fail, as the error is sticky.
+*/
+func (c *Client) expire() {
+	c.b.seterr(ErrTimeout)
+	c.b.c.Close()
 }
 func NewClient(conn io.ReadWriteCloser) (c *Client) {
 	c = new(Client)
@@ -180,15 +196,44 @@ func NewClient(conn io.ReadWriteCloser) (c *Client) {
 	return
 }
 
+var ErrClientClosed = errors.New("mntp: client closed")
+
+/*
+Returns the first error of the connection: an I/O error or an error reply of
+the server (*ServerError). A Client, that had an error, is broken: every
+further request fails without touching the connection.
+
+The caps methods report a failed request as "not found"; use Err to tell
+both apart.
+*/
+func (c *Client) Err() error { return c.b.geterr() }
+
+// Closes the connection.
+func (c *Client) Close() error {
+	c.b.seterr(ErrClientClosed)
+	return c.b.c.Close()
+}
+
 type servergls struct {
 	ID [128]byte
 	AR fastnntp.ArticleRange
+	G  fastnntp.Group
 }
 
 type server struct {
 	b *iobuffer
 	rh fastnntp.Handler
 	gls servergls
+	
+	// Protocol version of the client. 0 if it did not send HELLO.
+	peerVersion int
+	
+	// The nonce sent in the HELLO reply (version >= 3).
+	nonce string
+	
+	cfg  *ServerConfig
+	tls  *tls.ConnectionState
+	peer *Peer
 }
 
 func ServeConn(conn io.ReadWriteCloser, rh fastnntp.Handler) {
@@ -200,17 +245,50 @@ func ServeConn(conn io.ReadWriteCloser, rh fastnntp.Handler) {
 
 type handlerFunc func(s *server,args [][]byte) error
 var mntpCommands = make(map[string]handlerFunc)
-var noop = []byte("\n")
 func (s *server) serve() {
+	// A panic (eg. in a backend) leaves the connection in an unknown state:
+	// report it and close the connection.
+	defer func() {
+		if r := recover(); r!=nil {
+			s.writeError(ErrCodeInternal,fmt.Sprint(r))
+			s.b.flush()
+			s.b.c.Close()
+		}
+	}()
 	for {
+		s.idleDeadline()
 		args,err := s.b.readSplit()
-		if err!=nil { return }
-		if len(args)==0 { s.b.c.Write(noop); continue }
-		// MNTP is case sensitive!
-		handler,ok := mntpCommands[string(args[0])]
-		if !ok  { s.b.c.Write(noop); continue }
-		err = handler(s,args)
-		if err!=nil { return }
+		if s.b.geterr()!=nil { return }
+		if err==nil {
+			err = s.dispatch(args)
+		} else if len(args)>0 {
+			err = s.refuse(string(args[0]),ErrCodeSyntax,err.Error())
+		} else {
+			err = s.syntax(err)
+		}
+		if errsel(err,s.b.flush())!=nil { return }
 	}
 }
+func (s *server) dispatch(args [][]byte) error {
+	if len(args)==0 { return s.b.writeSplit() }
+	// MNTP is case sensitive!
+	if s.authRequired(string(args[0])) {
+		return s.refuse(string(args[0]),ErrCodeAuthRequired,string(args[0]))
+	}
+	handler,ok := mntpCommands[string(args[0])]
+	if !ok { return s.writeError(ErrCodeUnknown,string(args[0])) }
+	return handler(s,args)
+}
+
+// Commands, whose request is followed by a dot-encoded block.
+var mntpDotRequests = map[string]bool{"POST":true}
 
+/*
+Answers a command with an error reply, without running its handler. The
+dot-encoded block of the request, if any, is consumed, as it would be read as
+commands otherwise.
+*/
+func (s *server) refuse(cmd, code, text string) error {
+	if mntpDotRequests[cmd] { ConsumeRelease(s.b.readDot()) }
+	return s.writeError(code,text)
+}
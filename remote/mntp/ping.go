@@ -0,0 +1,115 @@
+/*
+Copyright (c) 2021 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package mntpc
+
+import "context"
+import "errors"
+import "net"
+import "strconv"
+import "sync/atomic"
+import "time"
+
+var errShortReply = errors.New("mntp: short reply")
+var errBadPong = errors.New("mntp: unexpected reply to PING")
+
+/*
+Heartbeat:
+
+	PING token  ->  PONG token
+*/
+
+func handlePING(s *server,args [][]byte) error {
+	p := Args{F:args}
+	token := p.Bytes(1)
+	if p.Err!=nil { return s.syntax(p.Err) }
+	return s.b.writeSplit("PONG",token)
+}
+
+/*
+Checks, whether the server responds, using a PING round trip (or CHECK, if
+the server does not support PING). The deadline of ctx limits the round trip;
+if it expires, the connection is broken.
+*/
+func (c *Client) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err!=nil { return err }
+	ping := c.Supports("PING")
+	d := c.Timeout
+	if dl,ok := ctx.Deadline(); ok {
+		if r := time.Until(dl); d<=0 || r<d { d = r }
+		if d<=0 { return context.DeadlineExceeded }
+	}
+	L := c.reqTimeout(d); defer L.release()
+	
+	token := strconv.FormatInt(time.Now().UnixNano(),36)
+	var err error
+	if ping {
+		err = c.b.writeSplit("PING",token)
+	} else {
+		err = c.b.writeSplit("CHECK","")
+	}
+	if err!=nil { return err }
+	
+	L.resp()
+	
+	args,err := c.b.readReply()
+	if err!=nil { return err }
+	if err := replyError(args); err!=nil { return err }
+	if ping {
+		if string(getarg(args,0))!="PONG" || string(getarg(args,1))!=token { return errBadPong }
+	} else if len(args)<2 {
+		return errShortReply
+	}
+	return nil
+}
+
+/*
+Pings the server, whenever nothing (not even a part of a long response) has
+been received for 'interval'. If the server does not answer within 'interval'
+(or Timeout, if set), the connection is broken, so that a half-open
+connection is detected and all waiting requests fail. The heartbeat stops, once the Client is broken or closed.
+*/
+func (c *Client) StartHeartbeat(interval time.Duration) {
+	if interval<=0 { return }
+	go c.heartbeat(interval)
+}
+func (c *Client) heartbeat(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for range t.C {
+		if c.Err()!=nil { return }
+		idle := time.Duration(time.Now().UnixNano()-atomic.LoadInt64(&c.b.c.last))
+		if idle<interval { continue }
+		ctx,cancel := context.WithTimeout(context.Background(),interval)
+		c.Ping(ctx)
+		cancel()
+	}
+}
+
+// Sets the read deadline of the server connection, if it supports one.
+func (s *server) idleDeadline() {
+	if s.cfg==nil || s.cfg.IdleTimeout<=0 { return }
+	if nc,ok := s.b.c.raw.(net.Conn); ok { nc.SetReadDeadline(time.Now().Add(s.cfg.IdleTimeout)) }
+}
+
+func init() {
+	mntpCommands["PING"] = handlePING
+}
@@ -0,0 +1,307 @@
+/*
+Copyright (c) 2021 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package mntpc
+
+import (
+	"context"
+	"errors"
+	"github.com/byte-mug/fastnntp"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrNoBackend = errors.New("mntp: no backend available")
+
+type PoolConfig struct {
+	// Backend addresses.
+	Addrs []string
+	
+	// Connections per address. Defaults to 2.
+	PerAddr int
+	
+	// Opens a connection. Defaults to a TCP connection with DialTimeout.
+	// A custom Dial should time out as well: a slot, that is dialing, is not
+	// used by other requests, but the request, that dials, waits for it.
+	Dial func(addr string) (io.ReadWriteCloser,error)
+	
+	// Timeout of the default Dial. Defaults to 5s.
+	DialTimeout time.Duration
+	
+	// Optional: Called on every new Client, eg. to authenticate.
+	Setup func(c *Client) error
+	
+	// Reconnect backoff. Default to 100ms and 30s.
+	MinBackoff, MaxBackoff time.Duration
+	
+	// Number of attempts of an idempotent request. Defaults to 3.
+	Attempts int
+	
+	// Optional: Client.Timeout and the heartbeat interval of every Client.
+	Timeout, Heartbeat time.Duration
+}
+
+type slot struct {
+	addr        string
+	outstanding int32
+	dialing     int32
+	
+	mu       sync.Mutex
+	c        *Client
+	failures uint
+	retryAt  time.Time
+}
+
+/*
+A pooled client. It maintains PerAddr connections to every backend and sends
+every request over the connection with the least outstanding requests.
+Broken connections are reopened with exponential backoff. Idempotent requests
+are retried on other connections (failover).
+
+Pool implements the same fastnntp caps interfaces as Client.
+*/
+type Pool struct {
+	cfg    PoolConfig
+	slots  []*slot
+	closed int32
+}
+
+func NewPool(cfg PoolConfig) *Pool {
+	if cfg.PerAddr<=0 { cfg.PerAddr = 2 }
+	if cfg.DialTimeout<=0 { cfg.DialTimeout = 5*time.Second }
+	if cfg.Dial==nil {
+		t := cfg.DialTimeout
+		cfg.Dial = func(addr string) (io.ReadWriteCloser,error) { return net.DialTimeout("tcp",addr,t) }
+	}
+	if cfg.MinBackoff<=0 { cfg.MinBackoff = 100*time.Millisecond }
+	if cfg.MaxBackoff<=0 { cfg.MaxBackoff = 30*time.Second }
+	if cfg.Attempts<=0 { cfg.Attempts = 3 }
+	p := &Pool{cfg:cfg}
+	for _,a := range cfg.Addrs {
+		for i := 0; i<cfg.PerAddr; i++ { p.slots = append(p.slots,&slot{addr:a}) }
+	}
+	return p
+}
+
+/*
+Returns the client of the slot, connecting if necessary. The connection is
+opened without holding s.mu; meanwhile, the slot is marked as dialing and
+skipped by pick.
+*/
+func (p *Pool) client(s *slot) *Client {
+	s.mu.Lock()
+	if s.c!=nil && s.c.Err()==nil { c := s.c; s.mu.Unlock(); return c }
+	if s.c!=nil { s.c.Close(); s.c = nil }
+	if atomic.LoadInt32(&s.dialing)!=0 || atomic.LoadInt32(&p.closed)!=0 || time.Now().Before(s.retryAt) { s.mu.Unlock(); return nil }
+	atomic.StoreInt32(&s.dialing,1)
+	s.mu.Unlock()
+	
+	c,err := p.connect(s.addr)
+	
+	s.mu.Lock(); defer s.mu.Unlock()
+	atomic.StoreInt32(&s.dialing,0)
+	if err!=nil { p.backoff(s); return nil }
+	if atomic.LoadInt32(&p.closed)!=0 { c.Close(); return nil }
+	s.c = c
+	return c
+}
+func (p *Pool) connect(addr string) (*Client,error) {
+	conn,err := p.cfg.Dial(addr)
+	if err!=nil { return nil,err }
+	c := NewClient(conn)
+	c.Timeout = p.cfg.Timeout
+	if p.cfg.Setup!=nil {
+		if err = p.cfg.Setup(c); err!=nil { c.Close(); return nil,err }
+	}
+	c.StartHeartbeat(p.cfg.Heartbeat)
+	return c,nil
+}
+
+// Must be called with s.mu held.
+func (p *Pool) backoff(s *slot) {
+	d := p.cfg.MinBackoff<<s.failures
+	if d<=0 || d>p.cfg.MaxBackoff { d = p.cfg.MaxBackoff } else { s.failures++ }
+	s.retryAt = time.Now().Add(d)
+}
+
+func (p *Pool) done(s *slot, c *Client) {
+	atomic.AddInt32(&s.outstanding,-1)
+	s.mu.Lock(); defer s.mu.Unlock()
+	if c.Err()==nil { s.failures = 0; return }
+	if s.c==c {
+		s.c.Close()
+		s.c = nil
+		p.backoff(s)
+	}
+}
+
+/*
+Picks the usable slot with the least outstanding requests, that is not in
+'tried' and not dialing.
+*/
+func (p *Pool) pick(tried map[*slot]bool) (*slot,*Client) {
+	for {
+		var best *slot
+		for _,s := range p.slots {
+			if tried[s] || atomic.LoadInt32(&s.dialing)!=0 { continue }
+			if best==nil || atomic.LoadInt32(&s.outstanding)<atomic.LoadInt32(&best.outstanding) { best = s }
+		}
+		if best==nil { return nil,nil }
+		tried[best] = true
+		if c := p.client(best); c!=nil {
+			atomic.AddInt32(&best.outstanding,1)
+			return best,c
+		}
+	}
+}
+
+/*
+Performs a request. If the connection breaks and retry is true, the request
+is repeated on another connection (up to Attempts times).
+*/
+func (p *Pool) do(retry bool, f func(c *Client)) error {
+	tried := make(map[*slot]bool)
+	for n := 0; n<p.cfg.Attempts; n++ {
+		s,c := p.pick(tried)
+		if s==nil { return ErrNoBackend }
+		f(c)
+		err := c.Err()
+		p.done(s,c)
+		if err==nil || !retry { return err }
+	}
+	return ErrNoBackend
+}
+
+// Closes all connections. Requests, that are in progress, fail.
+func (p *Pool) Close() error {
+	atomic.StoreInt32(&p.closed,1)
+	for _,s := range p.slots {
+		s.mu.Lock()
+		if s.c!=nil { s.c.Close(); s.c = nil }
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Pings one connection per address. Returns the first error.
+func (p *Pool) Ping(ctx context.Context) (err error) {
+	seen := make(map[string]bool)
+	for _,s := range p.slots {
+		if seen[s.addr] { continue }
+		seen[s.addr] = true
+		c := p.client(s)
+		if c==nil { err = errsel(err,ErrNoBackend); continue }
+		err = errsel(err,c.Ping(ctx))
+	}
+	return
+}
+
+/* Caps */
+
+func (p *Pool) StatArticle(a *fastnntp.Article) (ok bool) {
+	saved := *a
+	p.do(true,func(c *Client) {
+		*a = saved
+		ok = c.StatArticle(a)
+	})
+	return
+}
+func (p *Pool) GetArticle(a *fastnntp.Article, head, body bool) func(w *fastnntp.DotWriter) {
+	saved := *a
+	buf := getMembuf()
+	var ok bool
+	err := p.do(true,func(c *Client) {
+		*a = saved
+		buf.Reset()
+		ok = c.GetArticleInto(a,head,body,buf)
+	})
+	if err!=nil || !ok {
+		buf.release()
+		return nil
+	}
+	return buf.writeToObject
+}
+
+type countOverview struct {
+	fastnntp.IOverview
+	n int
+}
+func (c *countOverview) WriteEntry(num int64, subject, from, date, msgId, refs []byte, lng, lines int64) error {
+	c.n++
+	return c.IOverview.WriteEntry(num,subject,from,date,msgId,refs,lng,lines)
+}
+
+func (p *Pool) WriteOverview(ar *fastnntp.ArticleRange) func(w fastnntp.IOverview) {
+	return func(w fastnntp.IOverview) {
+		cw := &countOverview{IOverview:w}
+		// Retry only, as long as nothing has been written.
+		tried := make(map[*slot]bool)
+		for n := 0; n<p.cfg.Attempts && cw.n==0; n++ {
+			s,c := p.pick(tried)
+			if s==nil { return }
+			c.WriteOverviewInto(ar,cw)
+			err := c.Err()
+			p.done(s,c)
+			if err==nil { return }
+		}
+	}
+}
+
+func (p *Pool) CheckPostId(id []byte) (wanted bool, possible bool) {
+	if p.do(true,func(c *Client) { wanted,possible = c.CheckPostId(id) })!=nil { return true,false }
+	return
+}
+func (p *Pool) CheckPost() (possible bool) {
+	p.do(true,func(c *Client) { possible = c.CheckPost() })
+	return
+}
+
+// Not retried: the article has been consumed.
+func (p *Pool) PerformPost(id []byte, r *fastnntp.DotReader) (rejected bool, failed bool) {
+	failed = true
+	if p.do(false,func(c *Client) { rejected,failed = c.PerformPost(id,r) })!=nil { return false,true }
+	return
+}
+
+func (p *Pool) GetGroup(g *fastnntp.Group) (ok bool) {
+	p.do(true,func(c *Client) { ok = c.GetGroup(g) })
+	return
+}
+
+// Not retried: the output may have been written partially.
+func (p *Pool) ListGroup(g *fastnntp.Group, w *fastnntp.DotWriter, first, last int64) {
+	p.do(false,func(c *Client) { c.ListGroup(g,w,first,last) })
+}
+func (p *Pool) CursorMoveGroup(g *fastnntp.Group, i int64, backward bool, id_buf []byte) (ni int64, id []byte, ok bool) {
+	p.do(true,func(c *Client) { ni,id,ok = c.CursorMoveGroup(g,i,backward,id_buf) })
+	return
+}
+
+// Not retried: the output may have been written partially.
+func (p *Pool) ListGroups(wm *fastnntp.WildMat, ila fastnntp.IListActive) (ok bool) {
+	p.do(false,func(c *Client) { ok = c.ListGroups(wm,ila) })
+	return
+}
@@ -28,8 +28,10 @@ import "github.com/byte-mug/fastnntp"
 
 
 func handleCHECK(s *server,args [][]byte) error {
+	p := Args{F:args}
 	var wanted,possible bool
-	id := getarg(args,1)
+	id := p.Bytes(1)
+	if p.Err!=nil { return s.syntax(p.Err) }
 	if s.rh.PostingCaps==nil {
 		wanted,possible = false,false
 	} else if len(id)>1 {
@@ -41,8 +43,13 @@ func handleCHECK(s *server,args [][]byte) error {
 }
 
 func handlePOST(s *server,args [][]byte) error {
-	id := getarg(args,1)
+	p := Args{F:args}
+	id := p.Bytes(1)
 	r := s.b.readDot()
+	if p.Err!=nil {
+		ConsumeRelease(r)
+		return s.syntax(p.Err)
+	}
 	if s.rh.PostingCaps==nil {
 		ConsumeRelease(r)
 		return s.b.writeSplit(false,false)
@@ -60,7 +67,10 @@ func (c *Client) CheckPostId(id []byte) (wanted bool, possible bool) {
 	
 	L.resp()
 	
-	args,_ := c.b.readSplit()
+	args,err := c.reply()
+	
+	// Unknown: don't make the peer believe, we had the article.
+	if err!=nil { return true,false }
 	wanted = argtrue(args,0)
 	possible = argtrue(args,1)
 	return
@@ -80,7 +90,10 @@ func (c *Client) PerformPost(id []byte, r *fastnntp.DotReader) (rejected bool, f
 	
 	L.resp()
 	
-	args,_ := c.b.readSplit()
+	args,err := c.reply()
+	
+	// The outcome is unknown, so the article may be sent again.
+	if err!=nil { return false,true }
 	rejected = !argtrue(args,0)
 	failed = !argtrue(args,1)
 	return